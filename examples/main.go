@@ -17,15 +17,11 @@ import (
 )
 
 var stub Account = Account{
-	ID: 1,
+	BaseAccount: goard.BaseAccount{ID: 1},
 }
 
 type Account struct {
-	ID int64
-}
-
-func (a *Account) GetID() int64 {
-	return a.ID
+	goard.BaseAccount
 }
 
 type App struct {
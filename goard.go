@@ -3,9 +3,13 @@ package goard
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,20 +17,44 @@ const (
 	DEFAULT_TTL     = 8 * time.Hour
 	DEFAULT_CLEANUP = 5 * time.Minute
 	DEFAULT_COST    = 10
+	DEFAULT_LOCKOUT = 15 * time.Minute
+	DEFAULT_UNLOCK  = 15 * time.Minute
 )
 
+// ExpiresInHeader carries the remaining session lifetime in seconds, see Config.ExposeExpiry
+const ExpiresInHeader = "X-Session-Expires-In"
+
+// ExpiringHeader flags responses admitted on a session past its expiry, see Config.ExpiryGrace
+const ExpiringHeader = "X-Session-Expiring"
+
 var (
 	ErrMethod       = errors.New("method not allowed")
+	ErrBodyTimeout  = errors.New("request body timeout")
+	ErrCookieConfig = errors.New("invalid cookie configuration")
+	ErrJWTConfig    = errors.New("invalid JWT configuration")
+	ErrUnsafeHasher = errors.New("unsafe hasher is not enabled")
 	ErrAccessDenied = errors.New("access denied")
 	ErrRoleConflict = errors.New("role already exists")
+	ErrTooManyRoles = errors.New("too many roles")
+	ErrLastAdmin    = errors.New("last admin role holder")
+	ErrRoleNotFound = errors.New("role not found")
+	ErrScopeDenied  = errors.New("scope denied")
+
+	ErrNoPermissions = errors.New("database keeps no permissions")
+	ErrUnknownTenant = errors.New("unknown tenant")
 
 	ErrCredentialsConflict = errors.New("credentials already exists")
 	ErrCredentialsNotFound = errors.New("credentials not found")
 	ErrCredentialsMismatch = errors.New("credentials mismatch")
+	ErrAccountLocked       = errors.New("account locked")
+	ErrBadUnlockToken      = errors.New("bad unlock token")
 
 	ErrBadCredentials  = errors.New("bad credentials")
+	ErrBadSessionID    = errors.New("bad session id")
+	ErrBadToken        = errors.New("bad session token")
 	ErrSessionNotFound = errors.New("session not found")
 	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionRevoked  = errors.New("session revoked")
 )
 
 type Config struct {
@@ -50,6 +78,106 @@ type Config struct {
 	TTL time.Duration
 	// CI - is cleanup interval for session store scan expired Goard sessions
 	CI time.Duration
+	// IDValidator - is session ID format check applied before any store lookup
+	IDValidator func(string) bool
+	// Locker - is optional lease shared between instances so only one runs the cleanup sweep
+	Locker Locker
+	// Stateless - makes Guard build sessions from container claims without a store lookup.
+	// Roles stay as issued until the token expires, so keep TTL short.
+	Stateless bool
+	// EpochStore - is the token generation RevokeAll bumps to refuse stateless tokens signed before it,
+	// in memory by default so set a shared one when running several instances
+	EpochStore EpochStore
+	// AccountPreprocessor - validates or rewrites the raw sign up account before App.CreateAccount
+	AccountPreprocessor func(context.Context, json.RawMessage) (json.RawMessage, error)
+	// CorrelationHeader - is response header Guard sets to the hashed session ID, e.g. X-Session-ID
+	CorrelationHeader string
+	// AllowQuarantinedReads - lets quarantined sessions through guarded GET/HEAD/OPTIONS requests
+	AllowQuarantinedReads bool
+	// OnAudit - receives events about privileged actions such as offboarding
+	OnAudit func(context.Context, AuditEvent)
+	// OrphanReaper - is notified of app accounts the sign up rollback and its retries failed to delete
+	OrphanReaper OrphanReaper
+	// OrphanQueue - retries failed sign up rollbacks in the background, in memory by default
+	OrphanQueue OrphanQueue
+	// RoleTTL - caps session lifetime for holders of a role, counted from sign in or role grant
+	RoleTTL map[string]time.Duration
+	// MaxRolesPerAccount - caps roles one account may hold, zero disables the cap
+	MaxRolesPerAccount int
+	// TenantResolver - extracts the tenant scoping sign in and sign up logins
+	TenantResolver func(*http.Request) string
+	// CleanupWorkers - is number of concurrent revocations per cleanup sweep, 0 or 1 sweeps sequentially
+	CleanupWorkers int
+	// JSONErrors - adds JSON bodies with stable error codes to error responses
+	JSONErrors bool
+	// NormalizePasswords - applies Unicode NFC to passwords before hashing and comparison
+	// (PRECIS OpaqueString). Enabling it on an existing database locks out users whose
+	// stored hash was computed from a non-NFC password until they reset it.
+	NormalizePasswords bool
+	// DebugAuthz - adds required vs held roles to Guard 403 bodies. NEVER enable in production.
+	DebugAuthz bool
+	// AccountRefresh - makes Guard re-fetch the session account once it is older than this, zero disables
+	AccountRefresh time.Duration
+	// ProtectedRole - is the role that can't be removed from its last holder, "admin" by default
+	ProtectedRole string
+	// ErrorHandler - receives background errors such as failed cleanup sweeps, logged by Logger by default
+	ErrorHandler func(error)
+	// Logger - receives Goard warnings and errors, slog.Default by default
+	Logger Logger
+	// Metrics - receives sign in, sign up, session count and hasher latency events, see MetricsHandler
+	Metrics Metrics
+	// ReturnAccount - makes SignUp answer 201 with the JSON encoded account returned by App.CreateAccount
+	ReturnAccount bool
+	// RoleChange - is what happens to live sessions holding a renamed or deleted role, RoleChangeRefresh by default
+	RoleChange RoleChangePolicy
+	// BodyTimeout - bounds the wait for SignIn and SignUp request bodies, answering 408 past it, zero disables
+	BodyTimeout time.Duration
+	// MaxAttempts - is failed sign ins of a login before it is locked out, zero disables lockout
+	MaxAttempts int
+	// LockoutDuration - is how long a locked login is refused and failures are remembered, 15 minutes by default
+	LockoutDuration time.Duration
+	// OnAccountLocked - is called once per lockout when a login reaches MaxAttempts, e.g. to warn its owner
+	OnAccountLocked func(ctx context.Context, login string, attempts int)
+	// OnUnlockRequested - delivers the single use token unlocking a locked login, e.g. by email.
+	// RequestUnlock answers 501 without it. See Unlock.
+	OnUnlockRequested func(ctx context.Context, login, token string)
+	// UnlockTTL - is how long an unlock token stays valid, 15 minutes by default
+	UnlockTTL time.Duration
+	// TrustForwardedFor - makes RateLimit key clients by X-Forwarded-For, enable only behind a proxy setting it
+	TrustForwardedFor bool
+	// CSRFKey - signs CSRF tokens, random per instance by default so set it when running several
+	CSRFKey []byte
+	// CSRFCookie - is the script readable cookie SignIn puts the CSRF token in, empty disables it
+	CSRFCookie string
+	// SignOutViaGet - lets SignOut accept GET links carrying the sign out token, see SignOutToken
+	SignOutViaGet bool
+	// ExposeExpiry - makes Guard report the remaining session lifetime in the X-Session-Expires-In header
+	ExposeExpiry bool
+	// SlidingExpiration - makes Guard extend sessions by TTL on every admitted request
+	SlidingExpiration bool
+	// MaxLifetime - caps sliding sessions past sign in, zero leaves them unbounded
+	MaxLifetime time.Duration
+	// RefreshTTL - is refresh token lifetime, SignIn hands one out in X-Refresh-Token when set, zero disables them
+	RefreshTTL time.Duration
+	// RefreshStore - keeps refresh tokens, in memory by default
+	RefreshStore RefreshStore
+	// MaxSessionsPerAccount - caps live sessions per account, signing in evicts the oldest.
+	// Zero allows any number, 1 keeps a single session per account.
+	MaxSessionsPerAccount int
+	// ExpiryGrace - keeps accepting sessions this long past expiry, flagged by the X-Session-Expiring header,
+	// to smooth over clock skew between services. Cleanup deletes sessions once the grace is over.
+	ExpiryGrace time.Duration
+	// RoleHierarchy - lists the roles each role implies, e.g. {"admin": {"editor"}, "editor": {"viewer"}},
+	// so role checks pass for holders of a higher role. New returns nil when the hierarchy has a cycle.
+	RoleHierarchy map[string][]string
+	// RoleProvider - serves and changes account roles in place of the Database. Time-boxed grants,
+	// role counting for ProtectedRole, renames and deletions still go to the Database.
+	RoleProvider RoleProvider
+	// RotateOnPasswordChange - moves the session changing its password to a new ID, see ChangePassword
+	RotateOnPasswordChange bool
+	// Scopes - lists the scopes a sign in may limit its session to, each with the roles allowed
+	// to request it, an empty list lets any account request it. See RequireScope.
+	Scopes map[string][]string
 }
 
 func New(config *Config) *Goard {
@@ -61,6 +189,10 @@ func New(config *Config) *Goard {
 		config.Hasher = NewBcryptHasher(DEFAULT_COST)
 	}
 
+	if m, ok := config.Hasher.(*multiHasher); ok && !m.valid() {
+		return nil
+	}
+
 	if config.Container == nil {
 		return nil
 	}
@@ -85,105 +217,491 @@ func New(config *Config) *Goard {
 		config.CI = DEFAULT_CLEANUP
 	}
 
+	if config.Logger == nil {
+		config.Logger = defaultLogger{}
+	}
+
+	if config.OrphanReaper == nil {
+		config.OrphanReaper = &logReaper{logger: config.Logger}
+	}
+
+	if config.OrphanQueue == nil {
+		config.OrphanQueue = NewMemoryOrphanQueue(config.OrphanReaper)
+	}
+
+	if config.ProtectedRole == "" {
+		config.ProtectedRole = "admin"
+	}
+
+	if config.IDValidator == nil {
+		config.IDValidator = UUIDValidator
+	}
+
+	if config.LockoutDuration == 0 {
+		config.LockoutDuration = DEFAULT_LOCKOUT
+	}
+
+	if config.UnlockTTL == 0 {
+		config.UnlockTTL = DEFAULT_UNLOCK
+	}
+
+	if len(config.CSRFKey) == 0 {
+		config.CSRFKey = make([]byte, 32)
+		if _, err := rand.Read(config.CSRFKey); err != nil {
+			return nil
+		}
+	}
+
+	if config.RefreshStore == nil {
+		config.RefreshStore = NewRefreshStore()
+	}
+
+	if config.EpochStore == nil {
+		config.EpochStore = NewEpochStore()
+	}
+
+	if c, ok := config.Container.(epochContainer); ok {
+		c.useEpochs(config.EpochStore)
+	}
+
+	if c, ok := config.Container.(loggingContainer); ok {
+		c.useLogger(config.Logger)
+	}
+
+	hierarchy, ok := newRoleHierarchy(config.RoleHierarchy)
+	if !ok {
+		return nil
+	}
+
+	if config.RoleProvider == nil {
+		config.RoleProvider = databaseRoles{db: config.Database}
+	}
+
+	if config.ErrorHandler == nil {
+		logger := config.Logger
+		config.ErrorHandler = func(err error) {
+			logger.Error("goard: background error", "err", err)
+		}
+	}
+
 	g := &Goard{
-		app:       config.App,
-		admin:     config.Admin,
-		database:  config.Database,
-		container: config.Container,
-		transport: config.Transport,
-		hasher:    config.Hasher,
-		validator: config.Validator,
-		store:     config.Store,
-		ttl:       config.TTL,
-		ci:        config.CI,
+		app:             config.App,
+		admin:           config.Admin,
+		database:        config.Database,
+		container:       config.Container,
+		transport:       config.Transport,
+		hasher:          config.Hasher,
+		validator:       config.Validator,
+		store:           &swapStore{store: config.Store},
+		ttl:             config.TTL,
+		ci:              config.CI,
+		validID:         config.IDValidator,
+		locker:          config.Locker,
+		stateless:       config.Stateless,
+		preprocess:      config.AccountPreprocessor,
+		correlation:     config.CorrelationHeader,
+		quarantineReads: config.AllowQuarantinedReads,
+		audit:           config.OnAudit,
+		reaper:          config.OrphanReaper,
+		orphans:         config.OrphanQueue,
+		roleTTL:         config.RoleTTL,
+		maxRoles:        config.MaxRolesPerAccount,
+		tenant:          config.TenantResolver,
+		workers:         config.CleanupWorkers,
+		jsonErrors:      config.JSONErrors,
+		normalize:       config.NormalizePasswords,
+		debugAuthz:      config.DebugAuthz,
+		accountRefresh:  config.AccountRefresh,
+		protectedRole:   config.ProtectedRole,
+		onError:         config.ErrorHandler,
+		logger:          config.Logger,
+		returnAccount:   config.ReturnAccount,
+		roleChange:      config.RoleChange,
+		bodyTimeout:     config.BodyTimeout,
+		lockout:         newLockout(config.MaxAttempts, config.LockoutDuration),
+		onLocked:        config.OnAccountLocked,
+		onUnlock:        config.OnUnlockRequested,
+		unlockTTL:       config.UnlockTTL,
+		trustForwarded:  config.TrustForwardedFor,
+		csrfKey:         config.CSRFKey,
+		csrfCookie:      config.CSRFCookie,
+		signOutViaGet:   config.SignOutViaGet,
+		exposeExpiry:    config.ExposeExpiry,
+		sliding:         config.SlidingExpiration,
+		maxLifetime:     config.MaxLifetime,
+		refreshTTL:      config.RefreshTTL,
+		refresher:       config.RefreshStore,
+		epochs:          config.EpochStore,
+		maxSessions:     config.MaxSessionsPerAccount,
+		grace:           config.ExpiryGrace,
+		scopes:          config.Scopes,
+		hierarchy:       hierarchy,
+		rotatePassword:  config.RotateOnPasswordChange,
+		roles:           config.RoleProvider,
+		metrics:         metrics{hook: config.Metrics},
 	}
 
 	return g
 }
 
 func (g *Goard) Open() error {
+	g.selfCheck()
+
 	if err := g.database.Migrate(context.Background()); err != nil {
 		return err
 	}
 
-	go g.cleanup(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+
+	go g.cleanup(ctx)
+	go g.orphans.Run(ctx, g.app.DeleteAccount)
+	return nil
+}
+
+// Close stops Goard background routines started by Open
+func (g *Goard) Close() error {
+	if g.cancel != nil {
+		g.cancel()
+	}
 	return nil
 }
 
+// SetAdminPassword rotates the superuser password and revokes all admin sessions
+func (g *Goard) SetAdminPassword(ctx context.Context, current, password string) error {
+	return g.setAdminPassword(ctx, current, password)
+}
+
+// RevokeAll invalidates every active session at once
+func (g *Goard) RevokeAll(ctx context.Context) error {
+	return g.revokeAll(ctx)
+}
+
+// StatusForError maps an error returned by Goard to the HTTP status its
+// handlers answer with, 500 for errors it doesn't know
+func StatusForError(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrMethod):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, ErrBodyTimeout):
+		return http.StatusRequestTimeout
+	case errors.Is(err, ErrBadCredentials):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAccountLocked):
+		return http.StatusTooManyRequests
+	case unauthenticated(err), errors.Is(err, ErrBadToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrAccessDenied),
+		errors.Is(err, ErrScopeDenied),
+		errors.Is(err, ErrCredentialsNotFound),
+		errors.Is(err, ErrCredentialsMismatch),
+		errors.Is(err, ErrBadUnlockToken):
+		return http.StatusForbidden
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrUnknownTenant):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCredentialsConflict),
+		errors.Is(err, ErrRoleConflict),
+		errors.Is(err, ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, ErrTooManyRoles):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrNoPermissions):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// unauthenticated reports whether err means the request has no valid
+// session (401), as opposed to a valid session lacking rights (403)
+func unauthenticated(err error) bool {
+	return errors.Is(err, ErrSessionNotFound) ||
+		errors.Is(err, ErrSessionExpired) ||
+		errors.Is(err, ErrSessionRevoked) ||
+		errors.Is(err, ErrBadSessionID)
+}
+
+// authCode is the stable JSON error code of an authentication failure
+func authCode(err error) string {
+	if errors.Is(err, ErrSessionExpired) {
+		return "session_expired"
+	} else if errors.Is(err, ErrSessionRevoked) {
+		return "session_revoked"
+	}
+	return "unauthenticated"
+}
+
+// writeError answers with a JSON error body carrying a stable code
+func (g *Goard) writeError(w http.ResponseWriter, status int, code string, rules []ValidationRule) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(struct {
+		Code  string           `json:"code"`
+		Rules []ValidationRule `json:"rules,omitempty"`
+	}{
+		Code:  code,
+		Rules: rules,
+	}); err != nil {
+		g.logger.Warn("goard: writing response failed", "err", err)
+	}
+}
+
+// writeDenial explains a Guard rejection, for debugging only
+func (g *Goard) writeDenial(w http.ResponseWriter, required, held []string) {
+	missing := []string{}
+	for _, role := range required {
+		if !slices.Contains(held, role) {
+			missing = append(missing, role)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(map[string][]string{
+		"required": required,
+		"held":     held,
+		"missing":  missing,
+	}); err != nil {
+		g.logger.Warn("goard: writing response failed", "err", err)
+	}
+}
+
+// reject answers a request the transport failed to read
+func reject(w http.ResponseWriter, err error) {
+	var methodErr *MethodError
+	if errors.As(err, &methodErr) {
+		w.Header().Set("Allow", methodErr.Allow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	} else if errors.Is(err, ErrMethod) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	} else if errors.Is(err, ErrBodyTimeout) {
+		w.WriteHeader(http.StatusRequestTimeout)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// bounded limits how long the transport may wait for the request body, see Config.BodyTimeout
+func (g *Goard) bounded(w http.ResponseWriter, r *http.Request) *http.Request {
+	if g.bodyTimeout <= 0 || r.Body == nil {
+		return r
+	}
+
+	deadline := time.Now().Add(g.bodyTimeout)
+
+	// Also free the connection when the server supports read deadlines
+	_ = http.NewResponseController(w).SetReadDeadline(deadline)
+
+	r = r.Clone(r.Context())
+	r.Body = &deadlineBody{ReadCloser: r.Body, deadline: deadline}
+	return r
+}
+
+// SetSessionState quarantines, reactivates or revokes a session
+func (g *Goard) SetSessionState(ctx context.Context, sessionID string, state SessionState) error {
+	return g.setSessionState(ctx, sessionID, state)
+}
+
+// RevokeAllForAccount signs the account out of every session
+func (g *Goard) RevokeAllForAccount(ctx context.Context, account int64) error {
+	return g.revokeAccount(ctx, account)
+}
+
+// FlagOutdatedHashes requires a password change from every account whose hash
+// predates the current hasher parameters and returns how many were flagged
+func (g *Goard) FlagOutdatedHashes(ctx context.Context) (int, error) {
+	return g.flagOutdatedHashes(ctx)
+}
+
+// SetRoleUntil grants the account a role that expires at until. The context
+// selects the tenant as for sign in (see WithTenant).
+func (g *Goard) SetRoleUntil(ctx context.Context, account int64, role string, until time.Time) error {
+	return g.setRoleUntil(ctx, account, role, until)
+}
+
+// AuthenticatePassword signs in without HTTP, e.g. for gRPC or CLI front ends.
+// The created session is stored, handing it out is up to the caller. Passing
+// scopes limits the session to them, see Config.Scopes.
+func (g *Goard) AuthenticatePassword(ctx context.Context, login, password string, scopes ...string) (*Session, error) {
+	return g.signin(ctx, login, password, scopes)
+}
+
+// Authorize returns the live session of sessionID without HTTP, see AuthenticatePassword
+func (g *Goard) Authorize(ctx context.Context, sessionID string) (*Session, error) {
+	return g.session(ctx, sessionID)
+}
+
+// RenameRole renames a role for every account, live sessions follow Config.RoleChange
+func (g *Goard) RenameRole(ctx context.Context, from, to string) error {
+	return g.renameRole(ctx, from, to)
+}
+
+// DeleteRole revokes a role from every account, live sessions follow Config.RoleChange
+func (g *Goard) DeleteRole(ctx context.Context, role string) error {
+	return g.deleteRole(ctx, role)
+}
+
+// RefreshAccount re-fetches the session account from the App
+func (g *Goard) RefreshAccount(ctx context.Context, sessionID string) error {
+	_, err := g.refreshAccount(ctx, sessionID)
+	return err
+}
+
 func (g *Goard) SignIn(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	login, password, err := g.transport.SignIn(r)
+	ctx := g.tenantContext(r)
+	r = g.bounded(w, r)
+	var login, password string
+	var scopes []string
+	var err error
+	if t, ok := g.transport.(ScopedTransport); ok {
+		login, password, scopes, err = t.SignInScoped(r)
+	} else {
+		login, password, err = g.transport.SignIn(r)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		reject(w, err)
 		return
 	}
 
-	session, err := g.signin(ctx, login, password)
+	session, err := g.signin(ctx, login, password, scopes)
 	if err != nil {
-		if errors.Is(err, ErrBadCredentials) {
-			w.WriteHeader(http.StatusBadRequest)
-		} else if errors.Is(err, ErrCredentialsNotFound) {
-			w.WriteHeader(http.StatusForbidden)
-		} else if errors.Is(err, ErrCredentialsMismatch) {
-			w.WriteHeader(http.StatusForbidden)
-		} else {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	g.checkTransport(r)
+
+	if g.refreshTTL > 0 && session.credentials.id != 0 {
+		token, err := g.issueRefresh(ctx, session, "")
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
-		return
+		w.Header().Set(RefreshTokenHeader, token)
 	}
 
+	g.writeSession(w, r, session)
+}
+
+// writeSession hands a new session out through the container and the transport
+func (g *Goard) writeSession(w http.ResponseWriter, r *http.Request, session *Session) {
 	g.container.SetSession(w, session)
-	w.WriteHeader(http.StatusOK)
+	g.setCSRFCookie(w, session)
+
+	if c, ok := g.container.(concealer); ok && c.httpOnly() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	writer, ok := g.transport.(SignInWriter)
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := writer.WriteSignIn(w, session); err != nil {
+		g.logger.Warn("goard: writing sign in response failed", append(sessionAttrs(session), "err", err)...)
+	}
 }
 
 func (g *Goard) SignUp(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := g.tenantContext(r)
+	r = g.bounded(w, r)
 	account, login, password, err := g.transport.SignUp(r)
+	if r.MultipartForm != nil {
+		// The server only cleans up the form of the request it handed in,
+		// not of a bounded clone
+		defer r.MultipartForm.RemoveAll()
+		ctx = withUploads(ctx, r.MultipartForm.File)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		reject(w, err)
 		return
 	}
 
-	if err := g.signup(ctx, account, login, password); err != nil {
-		if errors.Is(err, ErrBadCredentials) {
-			w.WriteHeader(http.StatusBadRequest)
-		} else if errors.Is(err, ErrCredentialsConflict) {
-			w.WriteHeader(http.StatusConflict)
-		} else if errors.Is(err, ErrCredentialsMismatch) {
-			w.WriteHeader(http.StatusForbidden)
+	created, err := g.signup(ctx, account, login, password)
+	if err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) && g.jsonErrors {
+			g.writeError(w, http.StatusBadRequest, "bad_credentials", invalid.Rules)
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(StatusForError(err))
 		}
 		return
 	}
+
+	if g.returnAccount {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(created); err != nil {
+			g.logger.Warn("goard: writing sign up response failed", "account", created.GetID(), "err", err)
+		}
+	}
 }
 
+// SignOut accepts POST only, unless Config.SignOutViaGet also lets in GET
+// requests carrying the session sign out token, see SignOutToken
 func (g *Goard) SignOut(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	if r.Method != http.MethodPost && (r.Method != http.MethodGet || !g.signOutViaGet) {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
 	session := g.container.GetSession(r)
 	if session == "" {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+
+	if r.Method == http.MethodGet && !g.validCSRF("signout", session, r.URL.Query().Get(SignOutTokenParam)) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	if err := g.signout(ctx, session); err != nil {
-		fmt.Println(err)
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	if clearer, ok := g.container.(SessionClearer); ok {
+		clearer.ClearSession(w, r)
 	}
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(http.StatusOK)
 }
 
 func (g *Goard) Guard(next http.Handler, filter func(*Session) bool) http.Handler {
+	return g.GuardPolicy(next, Filter(filter))
+}
+
+// GuardMethods is Guard answering 405 with an Allow header to requests of
+// other methods, before the session is looked at
+func (g *Goard) GuardMethods(next http.Handler, methods []string, filter func(*Session) bool) http.Handler {
+	guarded := g.Guard(next, filter)
+	allow := strings.Join(methods, ", ")
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		sessionID := g.container.GetSession(r)
-		if sessionID == "" {
-			w.WriteHeader(http.StatusUnauthorized)
+		if !slices.Contains(methods, r.Method) {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
-		session, err := g.session(ctx, sessionID)
+
+		guarded.ServeHTTP(w, r)
+	})
+}
+
+// GuardPolicy is Guard for filters describing their requirement, see Config.DebugAuthz
+func (g *Goard) GuardPolicy(next http.Handler, policy Policy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := g.resolve(r)
 		if err != nil {
-			if errors.Is(err, ErrSessionNotFound) {
-				w.WriteHeader(http.StatusUnauthorized)
-			} else if errors.Is(err, ErrSessionExpired) {
+			if unauthenticated(err) && g.jsonErrors {
+				g.writeError(w, http.StatusUnauthorized, authCode(err), nil)
+			} else if unauthenticated(err) {
 				w.WriteHeader(http.StatusUnauthorized)
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -191,12 +709,78 @@ func (g *Goard) Guard(next http.Handler, filter func(*Session) bool) http.Handle
 			return
 		}
 
-		if ok := filter(session); !ok {
+		if session.rolesStale {
+			if refreshed, err := g.refreshRoles(r.Context(), session); err != nil {
+				g.logger.Warn("goard: reloading session roles failed", append(sessionAttrs(session), "err", err)...)
+			} else {
+				session = refreshed
+			}
+		}
+
+		if g.stale(session) {
+			if refreshed, err := g.refreshAccount(r.Context(), session.id); err != nil {
+				g.logger.Warn("goard: refreshing session account failed", append(sessionAttrs(session), "err", err)...)
+			} else {
+				session = refreshed
+			}
+		}
+
+		if ok := g.admits(session, r) && allows(policy, session, r); !ok {
+			if required := policy.Required(); g.debugAuthz && len(required) > 0 {
+				g.writeDenial(w, required, session.EffectiveRoles())
+				return
+			}
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if g.sliding {
+			if extended, err := g.slide(r.Context(), session); err != nil {
+				g.logger.Warn("goard: extending session failed", append(sessionAttrs(session), "err", err)...)
+			} else if extended != session {
+				session = extended
+				g.container.SetSession(w, session)
+			}
+		}
+
+		if g.correlation != "" {
+			w.Header().Set(g.correlation, CorrelationID(session.id))
+		}
+
+		if session.expiring {
+			w.Header().Set(ExpiringHeader, "1")
+		}
+
+		if g.exposeExpiry {
+			w.Header().Set(ExpiresInHeader, strconv.Itoa(int(time.Until(session.exp).Seconds())))
+		}
+
+		ctx := WithSession(withIdentity(scoped(r.Context(), session), session), session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// allows asks the policy, and RequestPolicy about the request too
+func allows(policy Policy, session *Session, r *http.Request) bool {
+	if !policy.Allow(session) {
+		return false
+	}
+	if p, ok := policy.(RequestPolicy); ok {
+		return p.AllowRequest(session, r)
+	}
+	return true
+}
+
+// Optional resolves the session if present but never rejects the request
+func (g *Goard) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := g.resolve(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithSession(r.Context(), session)))
 	})
 }
 
@@ -210,18 +794,12 @@ func (g *Goard) SetRole(w http.ResponseWriter, r *http.Request) {
 
 	account, role, err := g.transport.SetRole(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		reject(w, err)
 		return
 	}
 
 	if err := g.setRole(ctx, sessionID, account, role); err != nil {
-		if errors.Is(err, ErrAccessDenied) {
-			w.WriteHeader(http.StatusForbidden)
-		} else if errors.Is(err, ErrRoleConflict) {
-			w.WriteHeader(http.StatusConflict)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
+		w.WriteHeader(StatusForError(err))
 		return
 	}
 
@@ -238,18 +816,295 @@ func (g *Goard) UnsetRole(w http.ResponseWriter, r *http.Request) {
 
 	account, role, err := g.transport.UnsetRole(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		reject(w, err)
 		return
 	}
 
 	if err := g.unsetRole(ctx, sessionID, account, role); err != nil {
-		if errors.Is(err, ErrAccessDenied) {
-			w.WriteHeader(http.StatusForbidden)
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetPermission grants a fine grained permission, authorized like SetRole. It
+// needs a PermissionDatabase and a PermissionTransport, answering 501 otherwise.
+func (g *Goard) SetPermission(w http.ResponseWriter, r *http.Request) {
+	g.changePermission(w, r, true)
+}
+
+// UnsetPermission revokes a fine grained permission, see SetPermission
+func (g *Goard) UnsetPermission(w http.ResponseWriter, r *http.Request) {
+	g.changePermission(w, r, false)
+}
+
+func (g *Goard) changePermission(w http.ResponseWriter, r *http.Request, grant bool) {
+	ctx := context.Background()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	transport, ok := g.transport.(PermissionTransport)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	read, change := transport.UnsetPermission, g.unsetPermission
+	if grant {
+		read, change = transport.SetPermission, g.setPermission
+	}
+
+	account, permission, err := read(r)
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	if err := change(ctx, sessionID, account, permission); err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ChangePassword replaces the password of the session account after checking
+// the current one and signs the account out of its other sessions. The
+// session making the change stays signed in, under a new ID when
+// Config.RotateOnPasswordChange is set. The superuser uses SetAdminPassword.
+func (g *Goard) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	transport, ok := g.transport.(PasswordTransport)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	current, password, err := transport.ChangePassword(g.bounded(w, r))
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	session, err := g.changePassword(ctx, sessionID, current, password)
+	if err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) && g.jsonErrors {
+			g.writeError(w, http.StatusBadRequest, "bad_credentials", invalid.Rules)
 		} else {
+			w.WriteHeader(StatusForError(err))
+		}
+		return
+	}
+
+	if session.id != sessionID {
+		g.container.SetSession(w, session)
+		g.setCSRFCookie(w, session)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RequestUnlock hands a token unlocking a locked login to
+// Config.OnUnlockRequested. It answers 202 whether the login is locked or not,
+// so it can't be used to probe logins.
+func (g *Goard) RequestUnlock(w http.ResponseWriter, r *http.Request) {
+	ctx := g.tenantContext(r)
+
+	transport, ok := g.transport.(UnlockTransport)
+	if !ok || g.lockout == nil || g.onUnlock == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	login, err := transport.RequestUnlock(g.bounded(w, r))
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	if err := g.requestUnlock(ctx, login); err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Unlock consumes a token issued by RequestUnlock and clears the failed sign
+// ins of its login, answering 403 for an unknown, used or expired token
+func (g *Goard) Unlock(w http.ResponseWriter, r *http.Request) {
+	transport, ok := g.transport.(UnlockTransport)
+	if !ok || g.lockout == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	token, err := transport.Unlock(g.bounded(w, r))
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	if err := g.unlock(token); err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Goard) ResetSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := g.adminSession(ctx, sessionID); err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	if err := g.revokeAll(ctx); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Goard) AvailableRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	roles, err := g.availableRoles(ctx, sessionID)
+	if err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		g.logger.Warn("goard: writing response failed", "err", err)
+	}
+}
+
+// CheckPermissions answers which of the requested permissions the session holds
+func (g *Goard) CheckPermissions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	transport, ok := g.transport.(CheckTransport)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	permissions, err := transport.CheckPermissions(r)
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	result, err := g.checkPermissions(ctx, sessionID, permissions)
+	if err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		g.logger.Warn("goard: writing response failed", "err", err)
+	}
+}
+
+func (g *Goard) Offboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	transport, ok := g.transport.(OffboardTransport)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	account, err := transport.Offboard(r)
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	if err := g.offboard(ctx, sessionID, account); err != nil {
+		var partial *OffboardError
+		if errors.As(err, &partial) {
+			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusInternalServerError)
+			if err := json.NewEncoder(w).Encode(map[string]bool{
+				"sessions":    partial.Sessions == nil,
+				"credentials": partial.Credentials == nil,
+				"account":     partial.Account == nil,
+			}); err != nil {
+				g.logger.Warn("goard: writing response failed", "err", err)
+			}
+		} else {
+			w.WriteHeader(StatusForError(err))
 		}
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (g *Goard) VerifyPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	transport, ok := g.transport.(VerifyTransport)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	password, err := transport.VerifyPassword(r)
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	if err := g.verifyPassword(ctx, sessionID, password); err != nil {
+		w.WriteHeader(StatusForError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,178 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lease is a cleaner lease shared by the fake lockers of several instances
+type lease struct {
+	mu     sync.Mutex
+	holder string
+	sweeps map[string]int
+}
+
+// fakeLocker is one instance's view of a lease
+type fakeLocker struct {
+	lease *lease
+	name  string
+}
+
+func (l *fakeLocker) TryLock(context.Context) (bool, error) {
+	l.lease.mu.Lock()
+	defer l.lease.mu.Unlock()
+	if l.lease.holder != "" && l.lease.holder != l.name {
+		return false, nil
+	}
+	l.lease.holder = l.name
+	l.lease.sweeps[l.name]++
+	return true, nil
+}
+
+func (l *fakeLocker) Unlock(context.Context) error {
+	l.lease.mu.Lock()
+	defer l.lease.mu.Unlock()
+	l.lease.holder = ""
+	return nil
+}
+
+func TestSweepHonorsLocker(t *testing.T) {
+	ctx := context.Background()
+	shared := &lease{sweeps: map[string]int{}}
+	store, app, db := NewStore(), &testApp{}, newTestDatabase(t)
+
+	a := newTestGoard(t, &Config{Store: store, App: app, Database: db, Locker: &fakeLocker{lease: shared, name: "a"}})
+	b := newTestGoard(t, &Config{Store: store, App: app, Database: db, Locker: &fakeLocker{lease: shared, name: "b"}})
+
+	signUpAccount(t, a, "alice", "Secret-pass-1")
+	if _, err := a.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(2 * DEFAULT_TTL)
+
+	// a holds the lease while b's sweep comes around
+	if ok, _ := a.locker.TryLock(ctx); !ok {
+		t.Fatal("a could not take the lease")
+	}
+	if err := b.sweep(ctx, past); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Count(ctx); n != 1 {
+		t.Fatalf("b swept without the lease, %d sessions left", n)
+	}
+
+	if err := a.sweep(ctx, past); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Count(ctx); n != 0 {
+		t.Fatalf("a's sweep left %d sessions", n)
+	}
+
+	if shared.sweeps["b"] != 0 {
+		t.Fatalf("b acquired the lease %d times, want 0", shared.sweeps["b"])
+	}
+}
+
+// slowStore takes a while to revoke and records how many revocations overlap
+type slowStore struct {
+	*store
+	delay   time.Duration
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (s *slowStore) RevokeSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	s.running++
+	s.peak = max(s.peak, s.running)
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+	return s.store.RevokeSession(ctx, id)
+}
+
+func TestSweepWorkers(t *testing.T) {
+	const sessions = 100
+
+	store := &slowStore{store: NewStore(), delay: 10 * time.Millisecond}
+	g := newTestGoard(t, &Config{Store: store, CleanupWorkers: 8})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	for range sessions {
+		if _, err := g.AuthenticatePassword(context.Background(), "alice", "Secret-pass-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Overlapping revocations, not wall clock time, show the pool at work
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := g.sweep(ctx, time.Now().Add(2*DEFAULT_TTL)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := store.Count(ctx); n != 0 {
+		t.Fatalf("%d sessions left after the sweep", n)
+	}
+	if store.peak < 2 || store.peak > 8 {
+		t.Fatalf("%d concurrent revocations, want 2 to 8", store.peak)
+	}
+}
+
+// hiccupStore fails its first sweeps as an unreachable shared store would
+type hiccupStore struct {
+	*store
+	failures atomic.Int32
+}
+
+func (s *hiccupStore) ForEach(ctx context.Context, callback func(*Session) error) error {
+	if s.failures.Add(-1) >= 0 {
+		return errors.New("store unavailable")
+	}
+	return s.store.ForEach(ctx, callback)
+}
+
+func TestCleanupSurvivesStoreErrors(t *testing.T) {
+	store := &hiccupStore{store: NewStore()}
+	store.failures.Store(2)
+
+	failed := make(chan error, 8)
+	g := newTestGoard(t, &Config{
+		Store:        store,
+		CI:           20 * time.Millisecond,
+		ErrorHandler: func(err error) { failed <- err },
+	})
+	expired := &Session{id: "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b", exp: time.Now().Add(-time.Hour)}
+	if err := store.CreateSession(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	for range 2 {
+		select {
+		case <-failed:
+		case <-time.After(time.Second):
+			t.Fatal("failed sweep not reported")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for store.Count(context.Background()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("cleanup stopped sweeping after store errors")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
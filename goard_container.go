@@ -1,30 +1,267 @@
 package goard
 
-import "net/http"
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// cookieChunkSize keeps each cookie below the ~4KB browser limit
+	cookieChunkSize = 3800
+	// maxCookieChunks bounds how many chunk cookies are written or read back
+	maxCookieChunks = 8
+)
+
+func chunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// writeCookie sets value base64url encoded under the template cookie name,
+// sharding it across name.0, name.1, ... when it does not fit in a single
+// cookie. Any bytes survive the cookie transport.
+func writeCookie(w http.ResponseWriter, logger Logger, template http.Cookie, value string) {
+	value = base64.RawURLEncoding.EncodeToString([]byte(value))
+
+	if len(value) <= cookieChunkSize {
+		template.Value = value
+		http.SetCookie(w, &template)
+		return
+	}
+
+	if len(value) > cookieChunkSize*maxCookieChunks {
+		logger.Warn("goard: cookie value exceeds chunks, not set",
+			"cookie", template.Name, "bytes", len(value), "chunks", maxCookieChunks)
+		return
+	}
+
+	name := template.Name
+
+	// Drop a previous unsharded cookie, readCookie would prefer it
+	plain := template
+	plain.Value = ""
+	plain.MaxAge = -1
+	http.SetCookie(w, &plain)
+
+	n := 0
+	for ; len(value) > 0; n++ {
+		size := min(len(value), cookieChunkSize)
+		chunk := template
+		chunk.Name = chunkName(name, n)
+		chunk.Value = value[:size]
+		http.SetCookie(w, &chunk)
+		value = value[size:]
+	}
+
+	// Expire the chunk past the end so a stale tail is never reassembled
+	tail := template
+	tail.Name = chunkName(name, n)
+	tail.Value = ""
+	tail.MaxAge = -1
+	http.SetCookie(w, &tail)
+}
+
+// readCookie returns the value written by writeCookie, empty if absent or malformed
+func readCookie(r *http.Request, name string) string {
+	var value strings.Builder
+	if cookie, err := r.Cookie(name); err == nil {
+		value.WriteString(cookie.Value)
+	} else {
+		for i := 0; i < maxCookieChunks; i++ {
+			cookie, err := r.Cookie(chunkName(name, i))
+			if err != nil {
+				break
+			}
+			value.WriteString(cookie.Value)
+		}
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(value.String())
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
+
+// clearCookie expires the cookie and every chunk of it sent with the request
+func clearCookie(w http.ResponseWriter, r *http.Request, template http.Cookie) {
+	name := template.Name
+	template.Value = ""
+	template.MaxAge = -1
+	http.SetCookie(w, &template)
+
+	for _, cookie := range r.Cookies() {
+		if suffix, ok := strings.CutPrefix(cookie.Name, name+"."); ok {
+			if _, err := strconv.Atoi(suffix); err == nil {
+				chunk := template
+				chunk.Name = cookie.Name
+				http.SetCookie(w, &chunk)
+			}
+		}
+	}
+}
+
+// CookieOptions are the session cookie attributes
+type CookieOptions struct {
+	// SameSite - is the cookie SameSite mode, SameSiteNoneMode requires Secure
+	SameSite http.SameSite
+	// Secure - restricts the cookie to HTTPS
+	Secure bool
+	// Partitioned - keys the cookie by top-level site (CHIPS) for embedded contexts, requires Secure
+	Partitioned bool
+	// Path - is the cookie path, "/" by default
+	Path string
+	// Domain - is the cookie domain, empty keeps it host-only
+	Domain string
+}
+
+func (o *CookieOptions) validate() error {
+	if o.SameSite == http.SameSiteNoneMode && !o.Secure {
+		return ErrCookieConfig
+	}
+	if o.Partitioned && !o.Secure {
+		return ErrCookieConfig
+	}
+	return nil
+}
+
+// diagnoser is implemented by containers able to report risky configuration
+type diagnoser interface {
+	// diagnose returns warnings about the static configuration
+	diagnose() []string
+	// secure reports whether the container only works over HTTPS
+	secure() bool
+}
+
+// concealer is implemented by containers keeping the session out of reach of
+// scripts, SignIn never echoes their session into the response body
+type concealer interface {
+	httpOnly() bool
+}
+
+// loggingContainer is implemented by containers logging their failures, New hands them Config.Logger
+type loggingContainer interface {
+	useLogger(Logger)
+}
 
 type cookiesContainer struct {
-	name string
+	name    string
+	options CookieOptions
+	logger  Logger
+}
+
+func (c *cookiesContainer) useLogger(logger Logger) {
+	c.logger = logger
+}
+
+// log returns the Goard logger, slog.Default for containers used on their own
+func (c *cookiesContainer) log() Logger {
+	if c.logger == nil {
+		return defaultLogger{}
+	}
+	return c.logger
+}
+
+func (c *cookiesContainer) cookie() http.Cookie {
+	return http.Cookie{
+		Name:        c.name,
+		Path:        c.options.Path,
+		Domain:      c.options.Domain,
+		HttpOnly:    true,
+		SameSite:    c.options.SameSite,
+		Secure:      c.options.Secure,
+		Partitioned: c.options.Partitioned,
+	}
 }
 
 func (c *cookiesContainer) SetSession(w http.ResponseWriter, s *Session) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     c.name,
-		Value:    s.id,
-		HttpOnly: true,
-		Expires:  s.exp,
-	})
+	cookie := c.cookie()
+	cookie.Expires = s.exp
+	writeCookie(w, c.log(), cookie, s.id)
 }
 
 func (c *cookiesContainer) GetSession(r *http.Request) string {
-	cookie, err := r.Cookie(c.name)
-	if err != nil {
-		return ""
+	return readCookie(r, c.name)
+}
+
+// ClearSession implements SessionClearer.
+func (c *cookiesContainer) ClearSession(w http.ResponseWriter, r *http.Request) {
+	clearCookie(w, r, c.cookie())
+}
+
+func (c *cookiesContainer) diagnose() []string {
+	var warnings []string
+	if c.options.Partitioned && c.options.SameSite != http.SameSiteNoneMode {
+		warnings = append(warnings, "cookie "+c.name+" is Partitioned without SameSite=None, it is not sent in cross-site embeds")
 	}
-	return cookie.Value
+	return warnings
 }
 
+func (c *cookiesContainer) secure() bool {
+	return c.options.Secure
+}
+
+func (c *cookiesContainer) httpOnly() bool {
+	return true
+}
+
+// NewCookiesContainer sets a SameSite=Lax session cookie on path /
 func NewCookiesContainer(name string) Container {
 	return &cookiesContainer{
 		name: name,
+		options: CookieOptions{
+			SameSite: http.SameSiteLaxMode,
+			Path:     "/",
+		},
 	}
 }
+
+// NewCookiesContainerWithOptions returns ErrCookieConfig for attribute sets
+// browsers reject, e.g. SameSite=None without Secure. SameSite defaults to
+// Lax and Path to /.
+func NewCookiesContainerWithOptions(name string, options CookieOptions) (Container, error) {
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+
+	if options.Path == "" {
+		options.Path = "/"
+	}
+
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	return &cookiesContainer{
+		name:    name,
+		options: options,
+	}, nil
+}
+
+// SessionTokenHeader is the response header the bearer container writes the session ID to
+const SessionTokenHeader = "X-Session-Token"
+
+type bearerContainer struct{}
+
+// SetSession writes the session ID to the X-Session-Token response header
+func (b *bearerContainer) SetSession(w http.ResponseWriter, s *Session) {
+	w.Header().Set(SessionTokenHeader, s.id)
+}
+
+// GetSession returns the token of an "Authorization: Bearer <token>" header,
+// the scheme is matched case-insensitively
+func (b *bearerContainer) GetSession(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// NewBearerContainer reads sessions from the Authorization header for API
+// clients not using cookies. Sign in hands the session ID out in the
+// X-Session-Token response header, clients drop it themselves on sign out.
+func NewBearerContainer() Container {
+	return &bearerContainer{}
+}
@@ -0,0 +1,228 @@
+package goard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookiesContainerDiagnose(t *testing.T) {
+	container, err := NewCookiesContainerWithOptions("sid", CookieOptions{Secure: true, Partitioned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warnings := container.(diagnoser).diagnose(); len(warnings) != 1 {
+		t.Fatalf("Partitioned with SameSite=Lax: warnings = %q, want one", warnings)
+	}
+
+	container, err = NewCookiesContainerWithOptions("sid", CookieOptions{SameSite: http.SameSiteNoneMode, Secure: true, Partitioned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warnings := container.(diagnoser).diagnose(); len(warnings) != 0 {
+		t.Fatalf("warnings = %q, want none", warnings)
+	}
+}
+
+func TestCookiesContainerSameSiteNone(t *testing.T) {
+	container, err := NewCookiesContainerWithOptions("sid", CookieOptions{SameSite: http.SameSiteNoneMode, Secure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	container.SetSession(rec, &Session{id: "s1", exp: time.Now().Add(time.Hour)})
+
+	header := rec.Header().Get("Set-Cookie")
+	if !strings.Contains(header, "SameSite=None") || !strings.Contains(header, "Secure") {
+		t.Fatalf("Set-Cookie = %q, want SameSite=None with Secure", header)
+	}
+
+	if _, err := NewCookiesContainerWithOptions("sid", CookieOptions{SameSite: http.SameSiteNoneMode}); !errors.Is(err, ErrCookieConfig) {
+		t.Fatalf("SameSite=None without Secure: err = %v, want ErrCookieConfig", err)
+	}
+}
+
+func TestOpenWarnsAboutContainer(t *testing.T) {
+	container, err := NewCookiesContainerWithOptions("sid", CookieOptions{Secure: true, Partitioned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordLogger{}
+	g := newTestGoard(t, &Config{Container: container, Logger: logger})
+
+	if err := g.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if warnings := logger.logged("warn", "container misconfigured"); len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want one", warnings)
+	}
+}
+
+// roundTrip writes value as cookies and reads it back from a request carrying them
+func roundTrip(t *testing.T, value string) (string, []*http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	writeCookie(rec, defaultLogger{}, http.Cookie{Name: "sid", Path: "/"}, value)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	var sent []*http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			r.AddCookie(cookie)
+			sent = append(sent, cookie)
+		}
+	}
+	return readCookie(r, "sid"), sent
+}
+
+func TestCookieChunks(t *testing.T) {
+	value := strings.Repeat("0123456789abcdef", 7000/16)
+
+	got, sent := roundTrip(t, value)
+	if got != value {
+		t.Fatalf("read back %d bytes, want %d", len(got), len(value))
+	}
+	if len(sent) != 3 {
+		t.Fatalf("value spread over %d cookies, want 3", len(sent))
+	}
+	for i, cookie := range sent {
+		if want := "sid." + strconv.Itoa(i); cookie.Name != want {
+			t.Fatalf("cookie %d is %q, want %q", i, cookie.Name, want)
+		}
+		if len(cookie.Value) > cookieChunkSize {
+			t.Fatalf("cookie %s holds %d bytes, over %d", cookie.Name, len(cookie.Value), cookieChunkSize)
+		}
+	}
+}
+
+func TestOversizedCookieLoggedThroughGoard(t *testing.T) {
+	logger := &recordLogger{}
+	g := newTestGoard(t, &Config{Logger: logger})
+
+	rec := httptest.NewRecorder()
+	g.container.SetSession(rec, &Session{id: strings.Repeat("x", cookieChunkSize*maxCookieChunks), exp: time.Now().Add(time.Hour)})
+
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("oversized cookie was set")
+	}
+	if warnings := logger.logged("warn", "cookie value exceeds chunks"); len(warnings) != 1 {
+		t.Fatalf("warnings = %v, want one", warnings)
+	}
+}
+
+func TestBearerContainerGetSession(t *testing.T) {
+	container := NewBearerContainer()
+	for _, tc := range []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"missing", "", ""},
+		{"no token", "Bearer", ""},
+		{"other scheme", "Basic YWxpY2U6c2VjcmV0", ""},
+		{"glued scheme", "Bearertoken", ""},
+		{"canonical", "Bearer token", "token"},
+		{"lower case", "bearer token", "token"},
+		{"upper case", "BEARER token", "token"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		if got := container.GetSession(r); got != tc.want {
+			t.Errorf("%s: GetSession = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCookiesContainerPartitioned(t *testing.T) {
+	if _, err := NewCookiesContainerWithOptions("sid", CookieOptions{SameSite: http.SameSiteNoneMode, Partitioned: true}); !errors.Is(err, ErrCookieConfig) {
+		t.Fatalf("Partitioned without Secure: err = %v, want ErrCookieConfig", err)
+	}
+
+	container, err := NewCookiesContainerWithOptions("sid", CookieOptions{SameSite: http.SameSiteNoneMode, Secure: true, Partitioned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	container.SetSession(rec, &Session{id: "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b", exp: time.Now().Add(time.Hour)})
+
+	header := rec.Header().Get("Set-Cookie")
+	for _, attribute := range []string{"; Partitioned", "; SameSite=None", "; Secure"} {
+		if !strings.Contains(header, attribute) {
+			t.Errorf("Set-Cookie %q lacks %q", header, attribute)
+		}
+	}
+
+	// Unpartitioned cookies don't carry the attribute
+	rec = httptest.NewRecorder()
+	NewCookiesContainer("sid").SetSession(rec, &Session{id: "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b", exp: time.Now().Add(time.Hour)})
+	if header := rec.Header().Get("Set-Cookie"); strings.Contains(header, "Partitioned") {
+		t.Errorf("Set-Cookie %q is partitioned", header)
+	}
+}
+
+func TestCookiesContainerOptions(t *testing.T) {
+	setCookie := func(container Container) string {
+		rec := httptest.NewRecorder()
+		container.SetSession(rec, &Session{id: "s1", exp: time.Now().Add(time.Hour)})
+		return rec.Header().Get("Set-Cookie")
+	}
+
+	// Defaults
+	header := setCookie(NewCookiesContainer("sid"))
+	for _, attribute := range []string{"; Path=/", "; HttpOnly", "; SameSite=Lax"} {
+		if !strings.Contains(header, attribute) {
+			t.Errorf("default Set-Cookie %q lacks %q", header, attribute)
+		}
+	}
+	for _, attribute := range []string{"; Secure", "; Domain="} {
+		if strings.Contains(header, attribute) {
+			t.Errorf("default Set-Cookie %q has %q", header, attribute)
+		}
+	}
+
+	container, err := NewCookiesContainerWithOptions("sid", CookieOptions{
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+		Path:     "/app",
+		Domain:   "example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = setCookie(container)
+	for _, attribute := range []string{"; Path=/app", "; Domain=example.com", "; Secure", "; SameSite=Strict", "; HttpOnly"} {
+		if !strings.Contains(header, attribute) {
+			t.Errorf("Set-Cookie %q lacks %q", header, attribute)
+		}
+	}
+}
+
+func TestCookieEncoding(t *testing.T) {
+	// Separators, quotes, spaces, control and non UTF-8 bytes a raw cookie can't carry
+	value := "a;b,c \"d\"\\e=f\x00\x01\x7f\xff\xfe" + "é"
+
+	got, sent := roundTrip(t, value)
+	if got != value {
+		t.Fatalf("read back %q, want %q", got, value)
+	}
+	if len(sent) != 1 || strings.ContainsAny(sent[0].Value, ";, \"\\=") {
+		t.Fatalf("cookies sent %v", sent)
+	}
+
+	// Undecodable values read as no session
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "not*base64"})
+	if got := readCookie(r, "sid"); got != "" {
+		t.Fatalf("malformed cookie read as %q", got)
+	}
+}
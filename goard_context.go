@@ -0,0 +1,82 @@
+package goard
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+)
+
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	sessionIDKey
+	accountIDKey
+	tenantKey
+	uploadsKey
+)
+
+// WithSession returns a copy of ctx carrying the Goard session
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// SessionFromContext returns the Goard session resolved for the request by
+// Guard or Optional, if any
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey).(*Session)
+	return session, ok && session != nil
+}
+
+// withIdentity stores the session and account IDs for tracing and logging
+func withIdentity(ctx context.Context, session *Session) context.Context {
+	ctx = context.WithValue(ctx, sessionIDKey, session.id)
+	if session.account != nil {
+		ctx = context.WithValue(ctx, accountIDKey, session.account.GetID())
+	}
+	return ctx
+}
+
+// SessionIDFromContext returns the ID of the session guarding the request
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(sessionIDKey).(string)
+	return id, ok
+}
+
+// AccountIDFromContext returns the account ID of the session guarding the request
+func AccountIDFromContext(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(accountIDKey).(int64)
+	return id, ok
+}
+
+// CorrelationID is a non-secret identifier derived from a session ID,
+// safe to echo in headers and logs
+func CorrelationID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// WithTenant scopes credentials lookups made with ctx to a tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFromContext returns the tenant of ctx, empty for single-tenant setups
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey).(string)
+	return tenant
+}
+
+// withUploads passes the files of a multipart sign up on to App.CreateAccount
+func withUploads(ctx context.Context, files map[string][]*multipart.FileHeader) context.Context {
+	return context.WithValue(ctx, uploadsKey, files)
+}
+
+// UploadsFromContext returns the files of a multipart/form-data sign up by
+// field, for App.CreateAccount to read with FileHeader.Open. They are removed
+// once SignUp answers.
+func UploadsFromContext(ctx context.Context) (map[string][]*multipart.FileHeader, bool) {
+	files, ok := ctx.Value(uploadsKey).(map[string][]*multipart.FileHeader)
+	return files, ok
+}
@@ -2,40 +2,302 @@ package goard
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
 )
 
 type Goard struct {
-	app       App
-	store     Store
-	database  Database
-	transport Transport
-	container Container
-	validator Validator
-	hasher    Hasher
-	admin     Admin
-	ttl       time.Duration
-	ci        time.Duration
-}
-
-func (g *Goard) signinAsAdmin(ctx context.Context) (*Session, error) {
+	mu              sync.RWMutex
+	app             App
+	store           *swapStore
+	database        Database
+	transport       Transport
+	container       Container
+	validator       Validator
+	hasher          Hasher
+	admin           Admin
+	ttl             time.Duration
+	ci              time.Duration
+	validID         func(string) bool
+	locker          Locker
+	stateless       bool
+	preprocess      func(context.Context, json.RawMessage) (json.RawMessage, error)
+	correlation     string
+	quarantineReads bool
+	audit           func(context.Context, AuditEvent)
+	reaper          OrphanReaper
+	orphans         OrphanQueue
+	plainHTTP       sync.Once
+	roleTTL         map[string]time.Duration
+	maxRoles        int
+	tenant          func(*http.Request) string
+	workers         int
+	jsonErrors      bool
+	normalize       bool
+	debugAuthz      bool
+	accountRefresh  time.Duration
+	tmu             sync.Mutex
+	tombstones      map[string]time.Time
+	protectedRole   string
+	onError         func(error)
+	logger          Logger
+	returnAccount   bool
+	roleChange      RoleChangePolicy
+	bodyTimeout     time.Duration
+	lockout         *lockout
+	onLocked        func(ctx context.Context, login string, attempts int)
+	onUnlock        func(ctx context.Context, login, token string)
+	unlockTTL       time.Duration
+	trustForwarded  bool
+	csrfKey         []byte
+	csrfCookie      string
+	signOutViaGet   bool
+	exposeExpiry    bool
+	sliding         bool
+	maxLifetime     time.Duration
+	refreshTTL      time.Duration
+	refresher       RefreshStore
+	epochs          EpochStore
+	maxSessions     int
+	grace           time.Duration
+	metrics         metrics
+	scopes          map[string][]string
+	decoyOnce       sync.Once
+	decoyHash       string
+	hierarchy       roleHierarchy
+	rotatePassword  bool
+	roles           RoleProvider
+	cancel          context.CancelFunc
+}
+
+// invoke checks session ID format before hitting the store
+func (g *Goard) invoke(ctx context.Context, sessionID string) (*Session, error) {
+	if !g.validID(sessionID) {
+		return nil, ErrBadSessionID
+	}
+
+	return g.store.InvokeSession(ctx, sessionID)
+}
+
+// expiry tightens exp to the shortest per-role TTL counted from now
+func (g *Goard) expiry(now, exp time.Time, roles []string) time.Time {
+	for _, role := range roles {
+		ttl, ok := g.roleTTL[role]
+		if !ok {
+			continue
+		}
+		if limit := now.Add(ttl); limit.Before(exp) {
+			exp = limit
+		}
+	}
+	return exp
+}
+
+// slide extends a live session by TTL from now, up to MaxLifetime past sign in
+// and the RoleTTL caps counted from sign in. The same session is returned when
+// it can't be extended.
+func (g *Goard) slide(ctx context.Context, session *Session) (*Session, error) {
+	exp := time.Now().Add(g.ttl)
+	if g.maxLifetime > 0 {
+		if limit := session.iss.Add(g.maxLifetime); limit.Before(exp) {
+			exp = limit
+		}
+	}
+	exp = g.expiry(session.iss, exp, session.Roles())
+
+	if !exp.After(session.exp) {
+		return session, nil
+	}
+
+	updated := *session
+	updated.exp = exp
+	updated.expiring = false
+
+	// A session revoked meanwhile stays revoked
+	if err := g.store.UpdateSession(ctx, &updated); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return session, nil
+		}
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// tenantContext attaches the request tenant, if resolvable, to its context
+func (g *Goard) tenantContext(r *http.Request) context.Context {
+	if g.tenant == nil {
+		return r.Context()
+	}
+	return WithTenant(r.Context(), g.tenant(r))
+}
+
+// scoped routes database calls made with ctx to the session shard
+func scoped(ctx context.Context, session *Session) context.Context {
+	if session.shard == "" {
+		return ctx
+	}
+	return WithTenant(ctx, session.shard)
+}
+
+// canonical applies the password normalization policy, identical for
+// sign up, sign in and verification
+func (g *Goard) canonical(password string) string {
+	if !g.normalize {
+		return password
+	}
+	return norm.NFC.String(password)
+}
+
+// revoke ends a session before its expiry and remembers it until then, so
+// later requests carrying it are told apart from unknown sessions
+func (g *Goard) revoke(ctx context.Context, session *Session) error {
+	if err := g.store.RevokeSession(ctx, session.id); err != nil {
+		return err
+	}
+
+	g.tombstone(session)
+	return nil
+}
+
+func (g *Goard) tombstone(session *Session) {
+	g.tmu.Lock()
+	defer g.tmu.Unlock()
+	if g.tombstones == nil {
+		g.tombstones = make(map[string]time.Time)
+	}
+	g.tombstones[session.id] = session.exp
+}
+
+// revoked reports whether the session was revoked and has not expired yet
+func (g *Goard) revoked(sessionID string) bool {
+	g.tmu.Lock()
+	defer g.tmu.Unlock()
+	exp, ok := g.tombstones[sessionID]
+	return ok && time.Now().Before(exp)
+}
+
+// bury forgets tombstones of sessions that would have expired by t
+func (g *Goard) bury(t time.Time) {
+	g.tmu.Lock()
+	defer g.tmu.Unlock()
+	for id, exp := range g.tombstones {
+		if !t.Before(exp) {
+			delete(g.tombstones, id)
+		}
+	}
+}
+
+// evict revokes the oldest sessions of the account on the context tenant so a
+// new one fits within MaxSessionsPerAccount
+func (g *Goard) evict(ctx context.Context, account int64) error {
+	if g.maxSessions <= 0 {
+		return nil
+	}
+
+	tenant := TenantFromContext(ctx)
+	var live []*Session
+
+	if err := g.store.ForEach(ctx, func(s *Session) error {
+		if s.credentials != nil && s.credentials.id == account && s.shard == tenant {
+			live = append(live, s)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(live) < g.maxSessions {
+		return nil
+	}
+
+	slices.SortFunc(live, func(a, b *Session) int {
+		if c := a.iss.Compare(b.iss); c != 0 {
+			return c
+		}
+		return a.exp.Compare(b.exp)
+	})
+
+	for _, s := range live[:len(live)-g.maxSessions+1] {
+		if err := g.revoke(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// superuser returns a snapshot of the current admin credentials
+func (g *Goard) superuser() Admin {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.admin
+}
+
+// grantScopes checks the requested scopes are known and allowed to one of the
+// roles, the superuser may request any known scope
+func (g *Goard) grantScopes(scopes, roles []string, admin bool) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+
+	for _, scope := range scopes {
+		allowed, ok := g.scopes[scope]
+		if !ok {
+			return nil, ErrScopeDenied
+		}
+		if admin || len(allowed) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(allowed, func(role string) bool { return slices.Contains(roles, role) }) {
+			return nil, ErrScopeDenied
+		}
+	}
+
+	granted := slices.Clone(scopes)
+	slices.Sort(granted)
+	return slices.Compact(granted), nil
+}
+
+func (g *Goard) signinAsAdmin(ctx context.Context, scopes []string) (*Session, error) {
+	if err := g.evict(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	// The superuser is authorized by the admin flag, the protected role only
+	// lets role based policies recognize it
+	admin := g.superuser()
+	roles := []string{g.protectedRole}
+
+	granted, err := g.grantScopes(scopes, roles, true)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	session := &Session{
 		id:      uuid.New().String(),
-		account: g.admin.Account,
+		account: admin.Account,
 		credentials: &Credentials{
 			id:    0,
-			login: g.admin.Login,
-			roles: []string{"admin"},
+			login: admin.Login,
+			roles: roles,
 		},
-		exp: now.Add(g.ttl),
-		iss: now,
+		exp:       g.expiry(now, now.Add(g.ttl), roles),
+		iss:       now,
+		admin:     true,
+		shard:     TenantFromContext(ctx),
+		scopes:    granted,
+		hierarchy: g.hierarchy,
 	}
 
 	select {
@@ -50,52 +312,120 @@ func (g *Goard) signinAsAdmin(ctx context.Context) (*Session, error) {
 	return session, nil
 }
 
-func (g *Goard) signin(ctx context.Context, login, password string) (*Session, error) {
-	var err error
+// decoy spends a password comparison on an unknown login, so it takes as long
+// to refuse as a wrong password
+func (g *Goard) decoy(ctx context.Context, password string) {
+	g.decoyOnce.Do(func() {
+		hash, err := g.hash(ctx, uuid.New().String())
+		if err != nil {
+			g.onError(err)
+			return
+		}
+		g.decoyHash = hash
+	})
+
+	if g.decoyHash != "" {
+		g.compare(ctx, g.decoyHash, password)
+	}
+}
+
+// hash and compare time the Hasher for Config.Metrics
+func (g *Goard) hash(ctx context.Context, password string) (string, error) {
+	defer g.metrics.hasher("hash", time.Now())
+	return g.hasher.Hash(ctx, password)
+}
+
+func (g *Goard) compare(ctx context.Context, hash, password string) bool {
+	defer g.metrics.hasher("compare", time.Now())
+	return g.hasher.Compare(ctx, hash, password)
+}
+
+// requestUnlock issues an unlock token if the login is locked out
+func (g *Goard) requestUnlock(ctx context.Context, login string) error {
+	if login == "" {
+		return ErrBadCredentials
+	}
+
+	token, err := g.lockout.issue(lockKey(TenantFromContext(ctx), login), time.Now(), g.unlockTTL)
+	if err != nil || token == "" {
+		return err
+	}
+
+	g.onUnlock(ctx, login, token)
+	return nil
+}
+
+func (g *Goard) unlock(token string) error {
+	if token == "" || !g.lockout.redeem(token, time.Now()) {
+		return ErrBadUnlockToken
+	}
+	return nil
+}
+
+func (g *Goard) signin(ctx context.Context, login, password string, scopes []string) (_ *Session, err error) {
+	password = g.canonical(password)
 
 	if login == "" || password == "" {
+		g.metrics.signin(ErrBadCredentials)
 		return nil, ErrBadCredentials
 	}
 
+	key := lockKey(TenantFromContext(ctx), login)
+	if g.lockout.locked(key, time.Now()) {
+		g.metrics.signin(ErrAccountLocked)
+		return nil, ErrAccountLocked
+	}
+
+	defer func() {
+		g.metrics.signin(err)
+		if err == nil {
+			g.lockout.reset(key)
+		} else if errors.Is(err, ErrCredentialsMismatch) || errors.Is(err, ErrCredentialsNotFound) {
+			if count, locked := g.lockout.fail(key, time.Now()); locked && g.onLocked != nil {
+				g.onLocked(ctx, login, count)
+			}
+		}
+	}()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		if err = g.store.ForEach(ctx, func(s *Session) error {
-			if s.credentials.login != login {
-				return nil
-			}
-
-			if err := g.store.RevokeSession(ctx, s.id); err != nil {
-				return err
-			}
-
-			return nil
-		}); err != nil {
-			return nil, err
+		if admin := g.superuser(); login == admin.Login && password == admin.Password {
+			return g.signinAsAdmin(ctx, scopes)
 		}
 	}
 
+	var stored *Credentials
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		if login == g.admin.Login && password == g.admin.Password {
-			return g.signinAsAdmin(ctx)
+		if stored, err = g.database.CredentialsByLogin(ctx, login); err != nil {
+			if errors.Is(err, ErrCredentialsNotFound) {
+				g.decoy(ctx, password)
+			}
+			return nil, err
 		}
 	}
 
-	var credentials *Credentials
-
+	// Nothing but the comparison runs before the password is verified, so
+	// known logins take as long to refuse as unknown ones
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		if credentials, err = g.database.CredentialsByLogin(ctx, login); err != nil {
-			return nil, err
+		if ok := g.compare(ctx, stored.passhash, password); !ok {
+			return nil, ErrCredentialsMismatch
 		}
 	}
 
+	credentials, err := g.withRoles(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+
 	var account Account
 
 	select {
@@ -107,13 +437,21 @@ func (g *Goard) signin(ctx context.Context, login, password string) (*Session, e
 		}
 	}
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-		if ok := g.hasher.Compare(ctx, credentials.passhash, password); !ok {
-			return nil, ErrCredentialsMismatch
+	granted, err := g.grantScopes(scopes, credentials.roles, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = g.evict(ctx, credentials.id); err != nil {
+		return nil, err
+	}
+
+	// The password is verified, upgrade a hash made with outdated parameters
+	if rehasher, ok := g.hasher.(Rehasher); ok && rehasher.NeedsRehash(stored.passhash) {
+		if err := g.rehash(ctx, stored, password); err != nil {
+			g.onError(err)
 		}
+		credentials.passhash = stored.passhash
 	}
 
 	now := time.Now()
@@ -121,8 +459,11 @@ func (g *Goard) signin(ctx context.Context, login, password string) (*Session, e
 		id:          uuid.New().String(),
 		account:     account,
 		credentials: credentials,
-		exp:         now.Add(g.ttl),
+		exp:         g.expiry(now, now.Add(g.ttl), credentials.roles),
 		iss:         now,
+		shard:       TenantFromContext(ctx),
+		scopes:      granted,
+		hierarchy:   g.hierarchy,
 	}
 
 	select {
@@ -137,15 +478,50 @@ func (g *Goard) signin(ctx context.Context, login, password string) (*Session, e
 	return session, nil
 }
 
-func (g *Goard) signup(ctx context.Context, account json.RawMessage, login, password string) error {
-	var err error
+// rehash stores the password hashed with the current hasher parameters. Only
+// the hash is written, credentials were loaded before the slow hashing and
+// their roles may have changed since.
+func (g *Goard) rehash(ctx context.Context, credentials *Credentials, password string) error {
+	passhash, err := g.hash(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	if err := g.database.UpdatePasshash(ctx, credentials.id, passhash); err != nil {
+		return err
+	}
+
+	credentials.passhash = passhash
+	return nil
+}
+
+// signup returns the account created by the App
+func (g *Goard) signup(ctx context.Context, account json.RawMessage, login, password string) (_ Account, err error) {
+	defer func() { g.metrics.signup(err) }()
+
+	password = g.canonical(password)
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
-		if ok := g.validator.Validate(ctx, login, password); !ok {
-			return ErrBadCredentials
+		if v, ok := g.validator.(RuleValidator); ok {
+			if rules := v.Failures(ctx, login, password); len(rules) > 0 {
+				return nil, &ValidationError{Rules: rules}
+			}
+		} else if ok := g.validator.Validate(ctx, login, password); !ok {
+			return nil, ErrBadCredentials
+		}
+	}
+
+	if g.preprocess != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			if account, err = g.preprocess(ctx, account); err != nil {
+				return nil, errors.Join(ErrBadCredentials, err)
+			}
 		}
 	}
 
@@ -153,45 +529,47 @@ func (g *Goard) signup(ctx context.Context, account json.RawMessage, login, pass
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 		if acc, err = g.app.CreateAccount(ctx, account); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// Rollback application account
 	defer func() {
 		if err != nil {
-			if err := g.app.DeleteAccount(context.Background(), acc.GetID()); err != nil {
-				fmt.Println(err)
+			if rerr := g.app.DeleteAccount(context.Background(), acc.GetID()); rerr != nil {
+				if qerr := g.orphans.Enqueue(context.Background(), acc.GetID()); qerr != nil {
+					g.reaper.Reap(context.Background(), acc.GetID(), errors.Join(rerr, qerr))
+				}
 			}
 		}
 	}()
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 		if _, err = g.database.CredentialsByID(ctx, acc.GetID()); err != nil {
 			if !errors.Is(err, ErrCredentialsNotFound) {
-				return err
+				return nil, err
 			}
 		} else {
-			return ErrCredentialsConflict
+			return nil, ErrCredentialsConflict
 		}
 	}
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
-		if _, err := g.database.CredentialsByLogin(ctx, login); err != nil {
+		if _, err = g.database.CredentialsByLogin(ctx, login); err != nil {
 			if !errors.Is(err, ErrCredentialsNotFound) {
-				return err
+				return nil, err
 			}
 		} else {
-			return ErrCredentialsConflict
+			return nil, ErrCredentialsConflict
 		}
 	}
 
@@ -199,66 +577,151 @@ func (g *Goard) signup(ctx context.Context, account json.RawMessage, login, pass
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
-		if passhash, err = g.hasher.Hash(ctx, password); err != nil {
-			return err
+		if passhash, err = g.hash(ctx, password); err != nil {
+			return nil, err
 		}
 	}
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 		if err = g.database.CreateCredentials(ctx, &Credentials{
 			id:       acc.GetID(),
+			tenant:   TenantFromContext(ctx),
 			login:    login,
 			passhash: passhash,
 		}); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return acc, nil
 }
 
 func (g *Goard) signout(ctx context.Context, sessionID string) error {
+	if !g.validID(sessionID) {
+		return ErrBadSessionID
+	}
+
 	if g.store.Count(ctx) == 0 {
-		return nil
+		return ErrSessionNotFound
+	}
+
+	session, err := g.store.InvokeSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// The refresh token of this session would mint new ones past the sign out,
+	// those of the account's other devices stay
+	if session.credentials != nil {
+		if err := g.refresher.RevokeSession(ctx, session.id); err != nil {
+			return err
+		}
 	}
 
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		return g.store.RevokeSession(ctx, sessionID)
+		return g.revoke(ctx, session)
 	}
 }
 
 func (g *Goard) session(ctx context.Context, sessionID string) (*Session, error) {
+	if !g.validID(sessionID) {
+		return nil, ErrBadSessionID
+	}
+
+	if g.revoked(sessionID) {
+		return nil, ErrSessionRevoked
+	}
+
 	if g.store.Count(ctx) == 0 {
 		return nil, ErrSessionNotFound
 	}
 
 	now := time.Now()
-	session, err := g.store.InvokeSession(ctx, sessionID)
+	session, err := g.invoke(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	if session.exp.Unix() > now.Unix() {
+	if now.Before(session.exp) {
 		return session, nil
 	}
 
+	if now.Before(session.exp.Add(g.grace)) {
+		expiring := *session
+		expiring.expiring = true
+		return &expiring, nil
+	}
+
 	go func() {
 		if err := g.store.RevokeSession(context.Background(), sessionID); err != nil {
-			fmt.Println(err)
+			g.logger.Warn("goard: revoking expired session failed", "session", CorrelationID(sessionID), "err", err)
 		}
 	}()
 
 	return nil, ErrSessionExpired
 }
 
+// resolve finds the request session either from container claims or the store
+func (g *Goard) resolve(r *http.Request) (*Session, error) {
+	if decoder, ok := g.container.(ClaimsDecoder); ok && g.stateless {
+		claims, err := decoder.DecodeClaims(r)
+		if err != nil {
+			return nil, errors.Join(ErrBadSessionID, err)
+		}
+
+		if g.revoked(claims.SessionID) {
+			return nil, ErrSessionRevoked
+		}
+
+		return g.claimed(claims)
+	}
+
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		return nil, ErrSessionNotFound
+	}
+
+	return g.session(r.Context(), sessionID)
+}
+
+// claimed rebuilds a session from verified claims
+func (g *Goard) claimed(claims *Claims) (*Session, error) {
+	if !time.Now().Before(claims.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+
+	var account Account = BaseAccount{ID: claims.Account}
+	if claims.Admin {
+		account = g.superuser().Account
+	}
+
+	return &Session{
+		id:      claims.SessionID,
+		account: account,
+		credentials: &Credentials{
+			id:          claims.Account,
+			tenant:      claims.Shard,
+			roles:       claims.Roles,
+			permissions: claims.Permissions,
+			mustChange:  claims.MustChangePassword,
+		},
+		exp:       claims.ExpiresAt,
+		iss:       claims.IssuedAt,
+		admin:     claims.Admin,
+		shard:     claims.Shard,
+		scopes:    claims.Scopes,
+		hierarchy: g.hierarchy,
+	}, nil
+}
+
 func (g *Goard) cleanup(ctx context.Context) {
 	ticker := time.NewTicker(g.ci)
 	defer ticker.Stop()
@@ -270,97 +733,257 @@ loop:
 			break loop
 		case now := <-ticker.C:
 			go func(t time.Time) {
+				// Finish ahead of the next tick, a tenth early for short intervals
 				ctx, cancel := context.WithDeadline(ctx,
-					t.Add(time.Duration(g.ci.Milliseconds()-100)),
+					t.Add(g.ci-min(g.ci/10, 100*time.Millisecond)),
 				)
 				defer cancel()
 
-				if g.store.Count(ctx) == 0 {
-					return
+				// A failed sweep is retried on the next tick
+				err := g.sweep(ctx, t)
+				g.metrics.sweep(err)
+				if err != nil {
+					g.onError(err)
 				}
-
-				if err := g.store.ForEach(ctx, func(s *Session) error {
-					if s.exp.Unix() > t.Unix() {
-						return nil
-					}
-
-					if err := g.store.RevokeSession(ctx, s.ID()); err != nil {
-						return err
-					}
-
-					return nil
-				}); err != nil {
-					log.Fatal(err)
+				if g.metrics.hook != nil {
+					g.metrics.hook.ActiveSessions(g.store.Count(ctx))
 				}
 			}(now)
 		}
 	}
 }
 
-func (g *Goard) setRole(ctx context.Context, id string, account int64, role string) error {
-	session, err := g.store.InvokeSession(ctx, id)
-	if err != nil {
-		return err
-	}
+// sweep revokes sessions expired at t past the grace, provided this instance holds the cleaner lease
+func (g *Goard) sweep(ctx context.Context, t time.Time) error {
+	// Tombstones, lockouts and in memory refresh tokens are this instance's
+	// own, whoever holds the lease
+	g.bury(t)
+	g.lockout.prune(t)
 
-	if !session.admin {
-		return ErrAccessDenied
+	if _, local := g.refresher.(*refreshStore); local {
+		if err := g.refresher.DeleteExpiredRefresh(ctx, t); err != nil {
+			return err
+		}
 	}
 
-	credentials, err := g.database.CredentialsByID(ctx, account)
-	if err != nil {
-		return err
+	if g.locker != nil {
+		ok, err := g.locker.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		defer func() {
+			if err := g.locker.Unlock(context.Background()); err != nil {
+				g.onError(err)
+			}
+		}()
 	}
 
-	for i := range credentials.roles {
-		if credentials.roles[i] == role {
-			return ErrRoleConflict
+	if _, local := g.refresher.(*refreshStore); !local {
+		if err := g.refresher.DeleteExpiredRefresh(ctx, t); err != nil {
+			return err
 		}
 	}
 
-	credentials.roles = append(credentials.roles, role)
-
-	if err := g.database.UpdateCredentials(ctx, credentials); err != nil {
+	n, err := g.database.DeleteExpiredPermissions(ctx)
+	g.metrics.permissions.Add(n)
+	if err != nil {
 		return err
 	}
 
-	if err := g.store.ForEach(ctx, func(s *Session) error {
-		if s.credentials.id == credentials.id {
-			if err := g.store.CreateSession(ctx, &Session{
-				id:          s.id,
-				account:     s.account,
-				credentials: credentials,
-				exp:         s.exp,
-				iss:         s.iss,
-				admin:       s.admin,
-			}); err != nil {
+	if g.store.Count(ctx) == 0 {
+		return nil
+	}
+
+	if g.workers <= 1 {
+		return g.store.ForEach(ctx, func(s *Session) error {
+			if t.Before(s.exp.Add(g.grace)) {
+				return nil
+			}
+
+			if err := g.store.RevokeSession(ctx, s.ID()); err != nil {
 				return err
 			}
+			g.metrics.expired.Add(1)
+			return nil
+		})
+	}
+
+	expired := make([]string, 0)
+	if err := g.store.ForEach(ctx, func(s *Session) error {
+		if !t.Before(s.exp.Add(g.grace)) {
+			expired = append(expired, s.id)
 		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return g.revokeParallel(ctx, expired)
+}
+
+// revokeParallel revokes expired sessions on a bounded pool of workers, stopping at
+// the first error or when ctx is done
+func (g *Goard) revokeParallel(ctx context.Context, ids []string) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
 
+	for range g.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				if err := g.store.RevokeSession(ctx, id); err != nil {
+					cancel(err)
+					continue
+				}
+				g.metrics.expired.Add(1)
+			}
+		}()
+	}
+
+loop:
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			break loop
+		case queue <- id:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+func (g *Goard) setRole(ctx context.Context, id string, account int64, role string) error {
+	session, err := g.invoke(ctx, id)
+	if err != nil {
 		return err
-	}); err != nil {
+	}
+
+	if err := g.canManageRoles(ctx, session, account); err != nil {
+		return err
+	}
+
+	ctx = scoped(ctx, session)
+
+	credentials, err := g.credentialsByID(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	for i := range credentials.roles {
+		if credentials.roles[i] == role {
+			return ErrRoleConflict
+		}
+	}
+
+	if g.maxRoles > 0 && len(credentials.roles) >= g.maxRoles {
+		return ErrTooManyRoles
+	}
+
+	if err := g.roles.AddRole(ctx, account, role); err != nil {
+		return err
+	}
+
+	credentials.roles = append(credentials.roles, role)
+	slices.Sort(credentials.roles)
+
+	return g.updateSessions(ctx, credentials)
+}
+
+// setRoleUntil grants a role that lapses at until, extending or shortening an
+// existing time-boxed grant. Live sessions lose the role once it expires.
+func (g *Goard) setRoleUntil(ctx context.Context, account int64, role string, until time.Time) error {
+	credentials, err := g.credentialsByID(ctx, account)
+	if err != nil {
 		return err
 	}
 
+	held := slices.Contains(credentials.roles, role)
+	if _, boxed := credentials.until[role]; held && !boxed {
+		return ErrRoleConflict
+	}
+
+	if !held && g.maxRoles > 0 && len(credentials.roles) >= g.maxRoles {
+		return ErrTooManyRoles
+	}
+
+	if err := g.database.AddRoleUntil(ctx, account, role, until); err != nil {
+		return err
+	}
+
+	if !held {
+		credentials.roles = append(credentials.roles, role)
+		slices.Sort(credentials.roles)
+	}
+
+	boxed := make(map[string]time.Time, len(credentials.until)+1)
+	maps.Copy(boxed, credentials.until)
+	boxed[role] = until
+	credentials.until = boxed
+
+	return g.updateSessions(ctx, credentials)
+}
+
+// canManageRoles asks the App implementing RoleManager whether the actor may
+// change the account roles, only admins may otherwise
+func (g *Goard) canManageRoles(ctx context.Context, actor *Session, account int64) error {
+	manager, ok := g.app.(RoleManager)
+	if !ok {
+		if !actor.admin {
+			return ErrAccessDenied
+		}
+		return nil
+	}
+
+	allowed, err := manager.CanManageRoles(ctx, actor, account)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrAccessDenied
+	}
 	return nil
 }
 
 func (g *Goard) unsetRole(ctx context.Context, id string, account int64, role string) error {
-	session, err := g.store.InvokeSession(ctx, id)
+	session, err := g.invoke(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if !session.admin {
-		return ErrAccessDenied
+	if err := g.canManageRoles(ctx, session, account); err != nil {
+		return err
 	}
 
-	credentials, err := g.database.CredentialsByID(ctx, account)
+	ctx = scoped(ctx, session)
+
+	credentials, err := g.credentialsByID(ctx, account)
 	if err != nil {
 		return err
 	}
 
+	if role == g.protectedRole && slices.Contains(credentials.roles, role) {
+		holders, err := g.database.CountRole(ctx, role)
+		if err != nil {
+			return err
+		}
+		if holders <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	if err := g.roles.RemoveRole(ctx, account, role); err != nil {
+		return err
+	}
+
 	roles := make([]string, 0, len(credentials.roles))
 	for i := range credentials.roles {
 		if credentials.roles[i] != role {
@@ -370,28 +993,607 @@ func (g *Goard) unsetRole(ctx context.Context, id string, account int64, role st
 
 	credentials.roles = roles
 
-	if err := g.database.UpdateCredentials(ctx, credentials); err != nil {
+	return g.updateSessions(ctx, credentials)
+}
+
+// setPermission grants a fine grained permission, authorized like setRole
+func (g *Goard) setPermission(ctx context.Context, id string, account int64, permission string) error {
+	db, ok := g.database.(PermissionDatabase)
+	if !ok {
+		return ErrNoPermissions
+	}
+
+	session, err := g.invoke(ctx, id)
+	if err != nil {
 		return err
 	}
 
-	if err := g.store.ForEach(ctx, func(s *Session) error {
-		if s.credentials.id == credentials.id {
-			if err := g.store.CreateSession(ctx, &Session{
-				id:          s.id,
-				account:     s.account,
-				credentials: credentials,
-				exp:         s.exp,
-				iss:         s.iss,
-				admin:       s.admin,
-			}); err != nil {
-				return err
+	if err := g.canManageRoles(ctx, session, account); err != nil {
+		return err
+	}
+
+	ctx = scoped(ctx, session)
+
+	credentials, err := g.credentialsByID(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(credentials.permissions, permission) {
+		return nil
+	}
+
+	if err := db.AddPermission(ctx, account, permission); err != nil {
+		return err
+	}
+
+	credentials.permissions = append(slices.Clone(credentials.permissions), permission)
+	slices.Sort(credentials.permissions)
+
+	return g.updateSessions(ctx, credentials)
+}
+
+func (g *Goard) unsetPermission(ctx context.Context, id string, account int64, permission string) error {
+	db, ok := g.database.(PermissionDatabase)
+	if !ok {
+		return ErrNoPermissions
+	}
+
+	session, err := g.invoke(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := g.canManageRoles(ctx, session, account); err != nil {
+		return err
+	}
+
+	ctx = scoped(ctx, session)
+
+	credentials, err := g.credentialsByID(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if err := db.RemovePermission(ctx, account, permission); err != nil {
+		return err
+	}
+
+	credentials.permissions = slices.DeleteFunc(slices.Clone(credentials.permissions), func(p string) bool {
+		return p == permission
+	})
+
+	return g.updateSessions(ctx, credentials)
+}
+
+func (g *Goard) renameRole(ctx context.Context, from, to string) error {
+	if from == g.protectedRole {
+		return ErrLastAdmin
+	}
+
+	if err := g.database.RenameRole(ctx, from, to); err != nil {
+		return err
+	}
+
+	return g.changeRole(ctx, from, to)
+}
+
+func (g *Goard) deleteRole(ctx context.Context, role string) error {
+	if role == g.protectedRole {
+		return ErrLastAdmin
+	}
+
+	if err := g.database.DeleteRole(ctx, role); err != nil {
+		return err
+	}
+
+	return g.changeRole(ctx, role, "")
+}
+
+// changeRole applies the role change policy to live sessions holding from,
+// to is empty for a deleted role. Stateless tokens keep their roles until expiry.
+func (g *Goard) changeRole(ctx context.Context, from, to string) error {
+	return g.store.ForEach(ctx, func(s *Session) error {
+		if s.credentials == nil || s.credentials.id == 0 || !slices.Contains(s.credentials.roles, from) {
+			return nil
+		}
+
+		switch g.roleChange {
+		case RoleChangeRevoke:
+			return g.revoke(ctx, s)
+		case RoleChangeOnGuard:
+			updated := *s
+			updated.rolesStale = true
+			return g.updateLive(ctx, &updated)
+		}
+
+		credentials := *s.credentials
+		credentials.roles = make([]string, 0, len(s.credentials.roles))
+		for _, role := range s.credentials.roles {
+			if role != from && role != to {
+				credentials.roles = append(credentials.roles, role)
 			}
 		}
+		if to != "" {
+			credentials.roles = append(credentials.roles, to)
+			slices.Sort(credentials.roles)
+		}
+
+		if until, ok := credentials.until[from]; ok {
+			credentials.until = maps.Clone(credentials.until)
+			delete(credentials.until, from)
+			if to != "" {
+				credentials.until[to] = until
+			}
+		}
+
+		updated := *s
+		updated.credentials = &credentials
+		updated.exp = g.expiry(time.Now(), s.exp, credentials.roles)
+
+		return g.updateLive(ctx, &updated)
+	})
+}
+
+// refreshRoles reloads the session credentials marked by RoleChangeOnGuard
+func (g *Goard) refreshRoles(ctx context.Context, session *Session) (*Session, error) {
+	credentials, err := g.credentialsByID(scoped(ctx, session), session.credentials.id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *session
+	updated.credentials = credentials
+	updated.rolesStale = false
+	updated.exp = g.expiry(time.Now(), session.exp, credentials.roles)
+
+	if err := g.store.UpdateSession(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// updateSessions replaces the credentials of every live session of the account
+func (g *Goard) updateSessions(ctx context.Context, credentials *Credentials) error {
+	return g.store.ForEach(ctx, func(s *Session) error {
+		if s.credentials.id != credentials.id {
+			return nil
+		}
+
+		updated := *s
+		updated.credentials = credentials
+		updated.rolesStale = false
+		updated.exp = g.expiry(time.Now(), s.exp, credentials.roles)
+
+		return g.updateLive(ctx, &updated)
+	})
+}
+
+// updateLive replaces a session found while iterating the store, skipping it
+// when it was revoked meanwhile
+func (g *Goard) updateLive(ctx context.Context, session *Session) error {
+	if err := g.store.UpdateSession(ctx, session); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (g *Goard) setAdminPassword(ctx context.Context, current, password string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if subtle.ConstantTimeCompare([]byte(current), []byte(g.admin.Password)) != 1 {
+		return ErrCredentialsMismatch
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if ok := g.validator.Validate(ctx, g.admin.Login, password); !ok {
+			return ErrBadCredentials
+		}
+	}
+
+	g.admin.Password = password
+
+	// Force every admin to sign in again with the new password, admin
+	// sessions are never handed refresh tokens
+	return g.store.ForEach(ctx, func(s *Session) error {
+		if !s.admin {
+			return nil
+		}
+
+		return g.revoke(ctx, s)
+	})
+}
+
+// adminSession resolves a session and ensures it belongs to the superuser
+func (g *Goard) adminSession(ctx context.Context, sessionID string) (*Session, error) {
+	session, err := g.session(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.admin {
+		return nil, ErrAccessDenied
+	}
 
+	return session, nil
+}
+
+func (g *Goard) revokeAll(ctx context.Context) error {
+	// Stateless tokens never reach the store, the epoch refuses them on every instance
+	if _, err := g.epochs.BumpEpoch(ctx); err != nil {
 		return err
+	}
+
+	// Remember the sessions first so they are reported as revoked afterwards
+	if err := g.store.ForEach(ctx, func(s *Session) error {
+		g.tombstone(s)
+		return nil
 	}); err != nil {
 		return err
 	}
 
+	if err := g.refresher.ResetRefresh(ctx); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return g.store.Reset(ctx)
+	}
+}
+
+func (g *Goard) checkPermissions(ctx context.Context, sessionID string, permissions []string) (map[string]bool, error) {
+	session, err := g.session(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.HasPermissions(permissions...), nil
+}
+
+func (g *Goard) availableRoles(ctx context.Context, sessionID string) ([]string, error) {
+	session, err := g.adminSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = scoped(ctx, session)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		return g.roles.ListRoles(ctx)
+	}
+}
+
+func (g *Goard) setSessionState(ctx context.Context, sessionID string, state SessionState) error {
+	session, err := g.invoke(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if state == SessionRevoked {
+		return g.revoke(ctx, session)
+	}
+
+	updated := *session
+	updated.state = state
+
+	return g.store.UpdateSession(ctx, &updated)
+}
+
+// admits reports whether a quarantined session may still reach a route
+func (g *Goard) admits(session *Session, r *http.Request) bool {
+	if session.state != SessionQuarantined {
+		return true
+	}
+
+	if !g.quarantineReads {
+		return false
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// revokeAccount ends the sessions and the refresh tokens of the account, the
+// tokens on the context tenant
+func (g *Goard) revokeAccount(ctx context.Context, account int64) error {
+	if err := g.refresher.RevokeAccount(ctx, TenantFromContext(ctx), account); err != nil {
+		return err
+	}
+
+	return g.store.ForEach(ctx, func(s *Session) error {
+		if s.credentials == nil || s.credentials.id != account {
+			return nil
+		}
+
+		return g.revoke(ctx, s)
+	})
+}
+
+func (g *Goard) offboard(ctx context.Context, sessionID string, account int64) error {
+	session, err := g.adminSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	ctx = scoped(ctx, session)
+
+	// Sign the user out first so a partial failure leaves no live access
+	failure := &OffboardError{
+		Sessions:    g.revokeAccount(ctx, account),
+		Credentials: g.database.DeleteCredentials(ctx, account),
+		Account:     g.app.DeleteAccount(ctx, account),
+	}
+
+	if errs := failure.Unwrap(); len(errs) > 0 {
+		err = failure
+	}
+
+	if g.audit != nil {
+		g.audit(ctx, AuditEvent{
+			Action: "offboard",
+			Actor:  session.credentials.id,
+			Target: account,
+			At:     time.Now(),
+			Err:    err,
+		})
+	}
+
+	return err
+}
+
+// selfCheck logs container misconfigurations that make auth fail silently
+func (g *Goard) selfCheck() {
+	if d, ok := g.container.(diagnoser); ok {
+		for _, warning := range d.diagnose() {
+			g.logger.Warn("goard: container misconfigured", "warning", warning)
+		}
+	}
+}
+
+// checkTransport warns once when Secure cookies are issued over plain HTTP
+func (g *Goard) checkTransport(r *http.Request) {
+	d, ok := g.container.(diagnoser)
+	if !ok || !d.secure() {
+		return
+	}
+
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		return
+	}
+
+	g.plainHTTP.Do(func() {
+		g.logger.Warn("goard: Secure session cookie issued over plain HTTP, browsers will drop it")
+	})
+}
+
+func (g *Goard) verifyPassword(ctx context.Context, sessionID, password string) error {
+	password = g.canonical(password)
+
+	if password == "" {
+		return ErrBadCredentials
+	}
+
+	session, err := g.session(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	ctx = scoped(ctx, session)
+
+	if admin := g.superuser(); session.admin {
+		if subtle.ConstantTimeCompare([]byte(password), []byte(admin.Password)) != 1 {
+			return ErrCredentialsMismatch
+		}
+		return nil
+	}
+
+	var credentials *Credentials
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if credentials, err = g.database.CredentialsByID(ctx, session.credentials.id); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if ok := g.compare(ctx, credentials.passhash, password); !ok {
+			return ErrCredentialsMismatch
+		}
+	}
+
 	return nil
 }
+
+// changePassword replaces the password of the session account and revokes the
+// other sessions of the account, told apart by ID so the current one is kept.
+// The returned session is the current one, moved to a new ID when rotating.
+func (g *Goard) changePassword(ctx context.Context, sessionID, current, password string) (*Session, error) {
+	current, password = g.canonical(current), g.canonical(password)
+
+	if current == "" || password == "" {
+		return nil, ErrBadCredentials
+	}
+
+	session, err := g.session(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.admin || session.credentials == nil {
+		return nil, ErrAccessDenied
+	}
+
+	ctx = scoped(ctx, session)
+
+	credentials, err := g.database.CredentialsByID(ctx, session.credentials.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok := g.compare(ctx, credentials.passhash, current); !ok {
+		return nil, ErrCredentialsMismatch
+	}
+
+	if v, ok := g.validator.(RuleValidator); ok {
+		if rules := v.Failures(ctx, credentials.login, password); len(rules) > 0 {
+			return nil, &ValidationError{Rules: rules}
+		}
+	} else if ok := g.validator.Validate(ctx, credentials.login, password); !ok {
+		return nil, ErrBadCredentials
+	}
+
+	if err := g.rehash(ctx, credentials, password); err != nil {
+		return nil, err
+	}
+
+	if credentials.mustChange {
+		if err := g.database.SetMustChangePassword(ctx, credentials.id, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.store.ForEach(ctx, func(s *Session) error {
+		if s.credentials == nil || s.credentials.id != credentials.id || s.id == session.id {
+			return nil
+		}
+		return g.revoke(ctx, s)
+	}); err != nil {
+		return nil, err
+	}
+
+	// A refresh token learnt with the old password must not outlive it
+	if err := g.refresher.RevokeAccount(ctx, session.shard, credentials.id); err != nil {
+		return nil, err
+	}
+
+	// The session making the change is no longer due one
+	if session.MustChangePassword() {
+		cleared := *session.credentials
+		cleared.mustChange = false
+		updated := *session
+		updated.credentials = &cleared
+
+		if !g.rotatePassword {
+			if err := g.store.UpdateSession(ctx, &updated); err != nil {
+				return nil, err
+			}
+		}
+		session = &updated
+	}
+
+	if !g.rotatePassword {
+		return session, nil
+	}
+
+	// A new ID defeats fixation of the session that proved the password
+	rotated := *session
+	rotated.id = uuid.New().String()
+	rotated.expiring = false
+
+	if err := g.store.CreateSession(ctx, &rotated); err != nil {
+		return nil, err
+	}
+
+	if err := g.revoke(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &rotated, nil
+}
+
+func (g *Goard) flagOutdatedHashes(ctx context.Context) (int, error) {
+	rehasher, ok := g.hasher.(Rehasher)
+	if !ok {
+		return 0, nil
+	}
+
+	flagged := 0
+
+	err := g.database.ForEachCredentials(ctx, func(c *Credentials) error {
+		if c.mustChange || !rehasher.NeedsRehash(c.passhash) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// Sharded databases visit every shard, write back to the one holding the account
+			if err := g.database.SetMustChangePassword(WithTenant(ctx, c.tenant), c.id, true); err != nil {
+				return err
+			}
+		}
+
+		flagged++
+		return nil
+	})
+
+	return flagged, err
+}
+
+func (g *Goard) refreshAccount(ctx context.Context, sessionID string) (*Session, error) {
+	session, err := g.invoke(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.credentials == nil || session.credentials.id == 0 {
+		return session, nil
+	}
+
+	var account Account
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		if account, err = g.app.AccountByID(scoped(ctx, session), session.credentials.id); err != nil {
+			return nil, err
+		}
+	}
+
+	updated := *session
+	updated.account = account
+	updated.refreshed = time.Now()
+
+	if err := g.store.UpdateSession(ctx, &updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// stale reports whether the session account snapshot is due for a refresh
+func (g *Goard) stale(session *Session) bool {
+	if g.accountRefresh <= 0 || g.stateless {
+		return false
+	}
+
+	fetched := session.refreshed
+	if fetched.IsZero() {
+		fetched = session.iss
+	}
+
+	return time.Since(fetched) >= g.accountRefresh
+}
@@ -0,0 +1,311 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore counts session lookups reaching the store
+type countingStore struct {
+	*store
+	invoked atomic.Int32
+}
+
+func (s *countingStore) InvokeSession(ctx context.Context, id string) (*Session, error) {
+	s.invoked.Add(1)
+	return s.store.InvokeSession(ctx, id)
+}
+
+func TestSessionIDValidation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("default", func(t *testing.T) {
+		store := &countingStore{store: NewStore()}
+		g := newTestGoard(t, &Config{Store: store})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+
+		session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range []string{"", "not-a-uuid", strings.Repeat("x", 36), "'; DROP TABLE sessions; --"} {
+			if _, err := g.Authorize(ctx, id); !errors.Is(err, ErrBadSessionID) {
+				t.Errorf("Authorize(%q) = %v, want ErrBadSessionID", id, err)
+			}
+		}
+		if n := store.invoked.Load(); n != 0 {
+			t.Fatalf("malformed IDs reached the store %d times", n)
+		}
+
+		if _, err := g.Authorize(ctx, session.ID()); err != nil {
+			t.Fatalf("Authorize(valid) = %v", err)
+		}
+		if n := store.invoked.Load(); n != 1 {
+			t.Fatalf("valid ID reached the store %d times, want 1", n)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		g := newTestGoard(t, &Config{IDValidator: func(id string) bool {
+			return strings.HasPrefix(id, "sess_")
+		}})
+
+		if _, err := g.Authorize(ctx, "sess_unknown"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Authorize(accepted) = %v, want ErrSessionNotFound", err)
+		}
+		if _, err := g.Authorize(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, ErrBadSessionID) {
+			t.Errorf("Authorize(rejected) = %v, want ErrBadSessionID", err)
+		}
+	})
+}
+
+func TestSetAdminPassword(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+
+	session, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.SetAdminPassword(ctx, "wrong", "Root-pass-2"); !errors.Is(err, ErrCredentialsMismatch) {
+		t.Fatalf("SetAdminPassword(wrong current) = %v, want ErrCredentialsMismatch", err)
+	}
+	if err := g.SetAdminPassword(ctx, "Root-pass-1", "Root-pass-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1"); err == nil {
+		t.Fatal("old admin password still signs in")
+	}
+	if _, err := g.AuthenticatePassword(ctx, "root", "Root-pass-2"); err != nil {
+		t.Fatalf("new admin password: %v", err)
+	}
+	if _, err := g.Authorize(ctx, session.ID()); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("admin session after rotation = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestSessionExpiryIsMonotonic(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A wall clock step can't be injected, so pin what makes expiry immune to
+	// it: the expiry keeps the monotonic reading, which time.Time comparisons
+	// prefer over the wall clock. String prints it as "m=±<seconds>".
+	if !strings.Contains(session.ExpiresAt().String(), " m=") {
+		t.Fatalf("ExpiresAt %v lost its monotonic reading", session.ExpiresAt())
+	}
+
+	// and neither Authorize nor a sweep at this instant drops the session
+	if _, err := g.Authorize(ctx, session.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.sweep(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Authorize(ctx, session.ID()); err != nil {
+		t.Fatalf("session swept before its expiry: %v", err)
+	}
+}
+
+// profile is an app account with a name the app may change
+type profile struct {
+	BaseAccount
+	Name string
+}
+
+// profileApp serves accounts from a mutable name table
+type profileApp struct {
+	*testApp
+	mu    sync.Mutex
+	names map[int64]string
+}
+
+func (a *profileApp) rename(id int64, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.names[id] = name
+}
+
+func (a *profileApp) AccountByID(ctx context.Context, id int64) (Account, error) {
+	if _, err := a.testApp.AccountByID(ctx, id); err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return profile{BaseAccount: BaseAccount{ID: id}, Name: a.names[id]}, nil
+}
+
+func TestRefreshAccount(t *testing.T) {
+	ctx := context.Background()
+	app := &profileApp{testApp: &testApp{}, names: map[int64]string{}}
+	g := newTestGoard(t, &Config{App: app})
+	alice := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.rename(alice, "Alice Liddell")
+	if err := g.RefreshAccount(ctx, session.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := g.Authorize(ctx, session.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account, ok := refreshed.Account().(profile); !ok || account.Name != "Alice Liddell" {
+		t.Fatalf("account = %#v, want the renamed profile", refreshed.Account())
+	}
+}
+
+func TestGuardRefreshesAccount(t *testing.T) {
+	app := &profileApp{testApp: &testApp{}, names: map[int64]string{}}
+	g := newTestGoard(t, &Config{App: app, AccountRefresh: time.Millisecond})
+	alice := signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	var name string
+	h := g.Guard(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		session, _ := SessionFromContext(r.Context())
+		name = session.Account().(profile).Name
+	}), func(*Session) bool { return true })
+
+	app.rename(alice, "Alice Liddell")
+	time.Sleep(5 * time.Millisecond)
+
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("Guard = %d, want 200", rec.Code)
+	}
+	if name != "Alice Liddell" {
+		t.Fatalf("guarded handler saw %q, want the renamed account", name)
+	}
+}
+
+// TestCoreWithoutHTTP drives a session through its life with the
+// transport-neutral API only, as a gRPC or CLI front end would
+func TestCoreWithoutHTTP(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{Scopes: map[string][]string{"read": nil, "write": nil}})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1"); !errors.Is(err, ErrCredentialsMismatch) {
+		t.Fatalf("wrong password = %v, want ErrCredentialsMismatch", err)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "nobody", "Secret-pass-1"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("unknown login = %v, want ErrCredentialsNotFound", err)
+	}
+
+	session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1", "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorized, err := g.Authorize(ctx, session.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorized.Account().GetID() != account || !authorized.HasScope("read") || authorized.HasScope("write") {
+		t.Fatalf("authorized account %d, scopes %v", authorized.Account().GetID(), authorized.Scopes())
+	}
+
+	if err := g.RevokeAllForAccount(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Authorize(ctx, session.ID()); err == nil {
+		t.Fatal("Authorize succeeded for a revoked session")
+	}
+}
+
+func TestMaxSessionsPerAccount(t *testing.T) {
+	ctx := context.Background()
+	for _, limit := range []int{1, 3, 0} {
+		g := newTestGoard(t, &Config{MaxSessionsPerAccount: limit})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+		signUpAccount(t, g, "bob", "Secret-pass-1")
+
+		bob, err := g.AuthenticatePassword(ctx, "bob", "Secret-pass-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sessions []*Session
+		for range 5 {
+			session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessions = append(sessions, session)
+		}
+
+		kept := len(sessions)
+		if limit > 0 {
+			kept = limit
+		}
+		for i, session := range sessions {
+			_, err := g.Authorize(ctx, session.ID())
+			if alive, want := err == nil, i >= len(sessions)-kept; alive != want {
+				t.Errorf("limit %d: session %d alive %v, want %v", limit, i, alive, want)
+			}
+		}
+		if _, err := g.Authorize(ctx, bob.ID()); err != nil {
+			t.Errorf("limit %d: another account's session evicted: %v", limit, err)
+		}
+	}
+}
+
+func TestSignInEvictsByAccountNotLogin(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{MaxSessionsPerAccount: 1})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	before, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The login changes while the session stored under the old one lives on
+	creds, err := g.database.CredentialsByID(ctx, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.login = "alicia"
+	if err := g.database.UpdateCredentials(ctx, creds); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := g.AuthenticatePassword(ctx, "alicia", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Authorize(ctx, before.ID()); err == nil {
+		t.Fatal("session under the old login survived the single session cap")
+	}
+	if _, err := g.Authorize(ctx, after.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Admin sessions carry no account and evict nothing
+	if _, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Authorize(ctx, after.ID()); err != nil {
+		t.Fatalf("admin sign in evicted an account session: %v", err)
+	}
+}
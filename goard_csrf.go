@@ -0,0 +1,86 @@
+package goard
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	// CSRFHeader is the request header GuardCSRF reads the token from
+	CSRFHeader = "X-CSRF-Token"
+	// SignOutTokenParam is the query parameter of GET sign out links
+	SignOutTokenParam = "token"
+)
+
+// csrfToken binds a token to the session, purpose separates tokens of different uses
+func (g *Goard) csrfToken(purpose, sessionID string) string {
+	mac := hmac.New(sha256.New, g.csrfKey)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (g *Goard) validCSRF(purpose, sessionID, token string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(g.csrfToken(purpose, sessionID)))
+}
+
+// CSRFToken returns the token GuardCSRF expects in the X-CSRF-Token header
+func (g *Goard) CSRFToken(session *Session) string {
+	return g.csrfToken("request", session.id)
+}
+
+// SignOutToken returns the token of a GET sign out link, e.g. /signout?token=...
+// It only works once, as the session is gone after signing out.
+func (g *Goard) SignOutToken(session *Session) string {
+	return g.csrfToken("signout", session.id)
+}
+
+// setCSRFCookie hands the CSRF token out in a script readable cookie, see Config.CSRFCookie
+func (g *Goard) setCSRFCookie(w http.ResponseWriter, session *Session) {
+	if g.csrfCookie == "" {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     g.csrfCookie,
+		Value:    g.CSRFToken(session),
+		Path:     "/",
+		Expires:  session.exp,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if d, ok := g.container.(diagnoser); ok {
+		cookie.Secure = d.secure()
+	}
+	http.SetCookie(w, cookie)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// GuardCSRF is Guard also requiring the session CSRF token in the X-CSRF-Token
+// header of unsafe requests, answering 403 when it is missing or wrong
+func (g *Goard) GuardCSRF(next http.Handler, filter func(*Session) bool) http.Handler {
+	guarded := g.Guard(next, filter)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) {
+			// Requests without a session are left to Guard
+			if sessionID := g.container.GetSession(r); sessionID != "" &&
+				!g.validCSRF("request", sessionID, r.Header.Get(CSRFHeader)) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+
+		guarded.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package goard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuardCSRF(t *testing.T) {
+	g := newTestGoard(t, &Config{CSRFCookie: "csrf"})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, request(http.MethodPost, `{"login":"alice","password":"Secret-pass-1"}`))
+	cookie := sessionCookie(t, rec)
+	var token string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "csrf" {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		t.Fatal("no CSRF cookie set on sign in")
+	}
+
+	other, err := g.AuthenticatePassword(context.Background(), "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := g.GuardCSRF(okHandler, func(*Session) bool { return true })
+	for _, tc := range []struct {
+		name   string
+		method string
+		token  string
+		want   int
+	}{
+		{"matching token", http.MethodPost, token, http.StatusOK},
+		{"missing token", http.MethodPost, "", http.StatusForbidden},
+		{"garbage token", http.MethodDelete, "not-a-token", http.StatusForbidden},
+		{"another session's token", http.MethodPost, g.CSRFToken(other), http.StatusForbidden},
+		{"safe GET", http.MethodGet, "", http.StatusOK},
+		{"safe HEAD", http.MethodHead, "", http.StatusOK},
+	} {
+		r := httptest.NewRequest(tc.method, "/", nil)
+		r.AddCookie(cookie)
+		if tc.token != "" {
+			r.Header.Set(CSRFHeader, tc.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	// Without a session Guard answers first
+	if rec := serve(h, http.MethodPost, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous POST: %d, want 401", rec.Code)
+	}
+}
+
+func TestSignOutViaGet(t *testing.T) {
+	signOut := func(g *Goard, cookie *http.Cookie, token string) int {
+		target := "/signout"
+		if token != "" {
+			target += "?" + SignOutTokenParam + "=" + token
+		}
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		g.SignOut(rec, r)
+		return rec.Code
+	}
+
+	g := newTestGoard(t, &Config{SignOutViaGet: true})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+	session, err := g.Authorize(context.Background(), cookieSession(g, cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := signOut(g, cookie, ""); code != http.StatusForbidden {
+		t.Fatalf("GET without token: %d, want 403", code)
+	}
+	if code := signOut(g, cookie, g.CSRFToken(session)); code != http.StatusForbidden {
+		t.Fatalf("GET with a request token: %d, want 403", code)
+	}
+	if _, err := g.Authorize(context.Background(), session.ID()); err != nil {
+		t.Fatalf("rejected sign out revoked the session: %v", err)
+	}
+
+	if code := signOut(g, cookie, g.SignOutToken(session)); code != http.StatusOK {
+		t.Fatalf("GET with the sign out token: %d, want 200", code)
+	}
+	if _, err := g.Authorize(context.Background(), session.ID()); err == nil {
+		t.Fatal("session alive after signing out")
+	}
+
+	// GET stays refused unless opted in
+	g = newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie = signInCookie(t, g, "alice", "Secret-pass-1")
+	session, err = g.Authorize(context.Background(), cookieSession(g, cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := signOut(g, cookie, g.SignOutToken(session)); code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET by default: %d, want 405", code)
+	}
+}
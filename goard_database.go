@@ -7,8 +7,55 @@ import (
 	"time"
 )
 
+// DatabaseOptions tune the SQL databases
+type DatabaseOptions struct {
+	// DeleteBatch - caps rows removed per statement by DeleteExpiredPermissions, 1000 by default
+	DeleteBatch int
+	// BatchPause - is the wait between delete batches letting other writers take the table
+	BatchPause time.Duration
+}
+
+// withDefaults fills the zero options
+func (o DatabaseOptions) withDefaults() DatabaseOptions {
+	if o.DeleteBatch <= 0 {
+		o.DeleteBatch = 1000
+	}
+	return o
+}
+
+// deleteInBatches runs query, which deletes at most the batch size passed as its
+// last argument, until it affects fewer rows and returns the total deleted
+func deleteInBatches(ctx context.Context, db *sql.DB, options DatabaseOptions, query string, args ...any) (int64, error) {
+	args = append(args, options.DeleteBatch)
+	var total int64
+
+	for {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		if n < int64(options.DeleteBatch) {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(options.BatchPause):
+		}
+	}
+}
+
 type postgresDatabase struct {
-	db *sql.DB
+	db      *sql.DB
+	options DatabaseOptions
 }
 
 func (p *postgresDatabase) Migrate(ctx context.Context) error {
@@ -25,18 +72,60 @@ func (p *postgresDatabase) Migrate(ctx context.Context) error {
 	CREATE TABLE IF NOT EXISTS 
 		goard_creds (
 			creds_id BIGINT NOT NULL UNIQUE,
-			creds_login VARCHAR(60) NOT NULL UNIQUE,
+			creds_tenant VARCHAR(60) NOT NULL DEFAULT '',
+			creds_login VARCHAR(60) NOT NULL,
 			creds_passhash VARCHAR(120) NOT NULL,
+			creds_must_change BOOLEAN NOT NULL DEFAULT FALSE,
 			created_at TIMESTAMPTZ NOT NULL,
 			updated_at TIMESTAMPTZ NOT NULL
 		)
 	;
 
+	ALTER TABLE 
+		goard_creds
+	ADD COLUMN IF NOT EXISTS
+		creds_tenant VARCHAR(60) NOT NULL DEFAULT ''
+	;
+
+	ALTER TABLE 
+		goard_creds
+	DROP CONSTRAINT IF EXISTS
+		goard_creds_creds_login_key
+	;
+
+	ALTER TABLE 
+		goard_creds
+	ADD COLUMN IF NOT EXISTS
+		creds_must_change BOOLEAN NOT NULL DEFAULT FALSE
+	;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS
+		goard_creds_tenant_login
+	ON
+		goard_creds (creds_tenant, creds_login)
+	;
+
 	CREATE TABLE IF NOT EXISTS 
 		goard_permissions (
 			creds_id BIGINT NOT NULL REFERENCES goard_creds(creds_id),
 			role_id INTEGER NOT NULL REFERENCES goard_roles(role_id),
-			created_at TIMESTAMPTZ NOT NULL
+			created_at TIMESTAMPTZ NOT NULL,
+			expires_at TIMESTAMPTZ
+		)
+	;
+
+	ALTER TABLE 
+		goard_permissions
+	ADD COLUMN IF NOT EXISTS
+		expires_at TIMESTAMPTZ
+	;
+
+	CREATE TABLE IF NOT EXISTS 
+		goard_creds_permissions (
+			creds_id BIGINT NOT NULL REFERENCES goard_creds(creds_id),
+			permission VARCHAR(120) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL,
+			UNIQUE (creds_id, permission)
 		)
 	;
 
@@ -59,6 +148,8 @@ func (p *postgresDatabase) createRoleIfNotExists(ctx context.Context, tx *sql.Tx
 		if !errors.Is(err, sql.ErrNoRows) {
 			return 0, err
 		}
+	} else {
+		return id, nil
 	}
 
 	if err := tx.QueryRowContext(ctx,
@@ -71,10 +162,53 @@ func (p *postgresDatabase) createRoleIfNotExists(ctx context.Context, tx *sql.Tx
 	return id, nil
 }
 
-func (p *postgresDatabase) rolesByCredentialsID(ctx context.Context, tx *sql.Tx, credsID int64) ([]string, error) {
+// permissionsByCredentialsID returns the sorted fine grained permissions
+func (p *postgresDatabase) permissionsByCredentialsID(ctx context.Context, tx *sql.Tx, credsID int64) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT permission FROM goard_creds_permissions WHERE creds_id = $1 ORDER BY permission;`,
+		credsID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AddPermission implements PermissionDatabase.
+func (p *postgresDatabase) AddPermission(ctx context.Context, credsID int64, permission string) error {
+	_, err := p.db.ExecContext(ctx,
+		`INSERT INTO goard_creds_permissions (creds_id, permission, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;`,
+		credsID, permission, time.Now(),
+	)
+	return err
+}
+
+// RemovePermission implements PermissionDatabase.
+func (p *postgresDatabase) RemovePermission(ctx context.Context, credsID int64, permission string) error {
+	_, err := p.db.ExecContext(ctx,
+		`DELETE FROM goard_creds_permissions WHERE creds_id = $1 AND permission = $2;`,
+		credsID, permission,
+	)
+	return err
+}
+
+// rolesByCredentialsID returns live grants and the expiry of the time-boxed ones.
+func (p *postgresDatabase) rolesByCredentialsID(ctx context.Context, tx *sql.Tx, credsID int64) ([]string, map[string]time.Time, error) {
 	const query = `
 	SELECT
-		goard_roles.role_name
+		goard_roles.role_name,
+		goard_permissions.expires_at
 	FROM
 		goard_permissions
 	JOIN 
@@ -82,42 +216,75 @@ func (p *postgresDatabase) rolesByCredentialsID(ctx context.Context, tx *sql.Tx,
 	ON 
 		goard_permissions.role_id = goard_roles.role_id
 	WHERE
-		goard_permissions.creds_id = $1;`
+		goard_permissions.creds_id = $1
+	AND
+		(goard_permissions.expires_at IS NULL OR goard_permissions.expires_at > NOW())
+	ORDER BY
+		goard_roles.role_name;`
 
 	rows, err := tx.QueryContext(ctx, query, credsID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	roles := []string{}
+	var until map[string]time.Time
 
 	for rows.Next() {
-		var role string
-		if err = rows.Scan(&role); err != nil {
-			return nil, err
+		var (
+			role    string
+			expires sql.NullTime
+		)
+		if err = rows.Scan(&role, &expires); err != nil {
+			return nil, nil, err
 		}
 		roles = append(roles, role)
+
+		if expires.Valid {
+			if until == nil {
+				until = map[string]time.Time{}
+			}
+			until[role] = expires.Time
+		}
 	}
 
-	return roles, nil
+	return roles, until, rows.Err()
 }
 
-func (p *postgresDatabase) createPermission(ctx context.Context, tx *sql.Tx, credsID int64, roleID int32) error {
-	var ok int
+// createPermission grants the role. Only AddRole sets permanent to turn an
+// existing time-boxed grant permanent, diffs such as UpdateCredentials leave an
+// existing grant alone so a stale role list can't revive a lapsed one.
+func (p *postgresDatabase) createPermission(ctx context.Context, tx *sql.Tx, credsID int64, roleID int32, permanent bool) error {
+	if permanent {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE goard_permissions SET expires_at = NULL WHERE creds_id = $1 AND role_id = $2;`,
+			credsID, roleID,
+		)
+		if err != nil {
+			return err
+		}
 
-	if err := tx.QueryRowContext(ctx,
-		`SELECT 1 FROM goard_permissions WHERE creds_id = $1 AND role_id = $2;`,
-		credsID, roleID,
-	).Scan(&ok); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			return nil
+		}
+	} else {
+		var ok int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT 1 FROM goard_permissions WHERE creds_id = $1 AND role_id = $2;`,
+			credsID, roleID,
+		).Scan(&ok); err == nil {
+			return nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
 			return err
 		}
 	}
 
 	if _, err := tx.ExecContext(ctx,
-		`INSERT INTO goard_permissions (creds_id, role_id) VALUES ($1, $2);`,
-		credsID, roleID,
+		`INSERT INTO goard_permissions (creds_id, role_id, created_at) VALUES ($1, $2, $3);`,
+		credsID, roleID, time.Now(),
 	); err != nil {
 		return err
 	}
@@ -151,11 +318,12 @@ func (p *postgresDatabase) CreateCredentials(ctx context.Context, credentials *C
 	INSERT INTO 
 		goard_creds (
 			creds_id,
+			creds_tenant,
 			creds_login,
 			creds_passhash
 		) 
 	VALUES 
-		($1, $2, $3) 
+		($1, $2, $3, $4) 
 	RETURNING
 		creds_id;`
 	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
@@ -169,6 +337,7 @@ func (p *postgresDatabase) CreateCredentials(ctx context.Context, credentials *C
 	var credsID int64
 	if err := tx.QueryRowContext(ctx, query,
 		credentials.id,
+		credentials.tenant,
 		credentials.login,
 		credentials.passhash,
 	).Scan(&credsID); err != nil {
@@ -180,7 +349,7 @@ func (p *postgresDatabase) CreateCredentials(ctx context.Context, credentials *C
 		if err != nil {
 			return err
 		}
-		if err = p.createPermission(ctx, tx, credsID, roleID); err != nil {
+		if err = p.createPermission(ctx, tx, credsID, roleID, false); err != nil {
 			return err
 		}
 	}
@@ -197,8 +366,10 @@ func (p *postgresDatabase) CredentialsByID(ctx context.Context, credsID int64) (
 	const query = `
 	SELECT
 		creds_id,
+		creds_tenant,
 		creds_login,
-		creds_passhash
+		creds_passhash,
+		creds_must_change
 	FROM
 		goard_creds
 	WHERE
@@ -215,8 +386,10 @@ func (p *postgresDatabase) CredentialsByID(ctx context.Context, credsID int64) (
 	creds := &Credentials{}
 	if err = tx.QueryRowContext(ctx, query, credsID).Scan(
 		&creds.id,
-		creds.login,
-		creds.passhash,
+		&creds.tenant,
+		&creds.login,
+		&creds.passhash,
+		&creds.mustChange,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCredentialsNotFound
@@ -224,7 +397,11 @@ func (p *postgresDatabase) CredentialsByID(ctx context.Context, credsID int64) (
 		return nil, err
 	}
 
-	if creds.roles, err = p.rolesByCredentialsID(ctx, tx, credsID); err != nil {
+	if creds.roles, creds.until, err = p.rolesByCredentialsID(ctx, tx, credsID); err != nil {
+		return nil, err
+	}
+
+	if creds.permissions, err = p.permissionsByCredentialsID(ctx, tx, credsID); err != nil {
 		return nil, err
 	}
 
@@ -235,17 +412,21 @@ func (p *postgresDatabase) CredentialsByID(ctx context.Context, credsID int64) (
 	return creds, nil
 }
 
-// CredentialsByLogin implements Database.
+// CredentialsByLogin implements Database. The lookup is scoped to the context tenant.
 func (p *postgresDatabase) CredentialsByLogin(ctx context.Context, login string) (*Credentials, error) {
 	const query = `
 	SELECT
 		creds_id,
+		creds_tenant,
 		creds_login,
-		creds_passhash
+		creds_passhash,
+		creds_must_change
 	FROM
 		goard_creds
 	WHERE
-		creds_login = $1;`
+		creds_tenant = $1
+	AND
+		creds_login = $2;`
 	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelReadCommitted,
 		ReadOnly:  true,
@@ -256,10 +437,12 @@ func (p *postgresDatabase) CredentialsByLogin(ctx context.Context, login string)
 	defer tx.Rollback()
 
 	creds := &Credentials{}
-	if err = tx.QueryRowContext(ctx, query, login).Scan(
+	if err = tx.QueryRowContext(ctx, query, TenantFromContext(ctx), login).Scan(
 		&creds.id,
-		creds.login,
-		creds.passhash,
+		&creds.tenant,
+		&creds.login,
+		&creds.passhash,
+		&creds.mustChange,
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCredentialsNotFound
@@ -267,7 +450,11 @@ func (p *postgresDatabase) CredentialsByLogin(ctx context.Context, login string)
 		return nil, err
 	}
 
-	if creds.roles, err = p.rolesByCredentialsID(ctx, tx, creds.id); err != nil {
+	if creds.roles, creds.until, err = p.rolesByCredentialsID(ctx, tx, creds.id); err != nil {
+		return nil, err
+	}
+
+	if creds.permissions, err = p.permissionsByCredentialsID(ctx, tx, creds.id); err != nil {
 		return nil, err
 	}
 
@@ -295,6 +482,13 @@ func (p *postgresDatabase) DeleteCredentials(ctx context.Context, credsID int64)
 		return err
 	}
 
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_creds_permissions WHERE creds_id = $1;`,
+		credsID,
+	); err != nil {
+		return err
+	}
+
 	if _, err = tx.ExecContext(ctx,
 		`DELETE FROM goard_creds WHERE creds_id = $1;`,
 		credsID,
@@ -317,7 +511,7 @@ func (p *postgresDatabase) UpdateCredentials(ctx context.Context, credentials *C
 	SET
 		creds_login = $1,
 		creds_passhash = $2,
-		creds_updated_at = $3
+		updated_at = $3
 	WHERE
 		creds_id = $4
 	;`
@@ -334,11 +528,12 @@ func (p *postgresDatabase) UpdateCredentials(ctx context.Context, credentials *C
 		credentials.login,
 		credentials.passhash,
 		time.Now(),
+		credentials.id,
 	); err != nil {
 		return err
 	}
 
-	prev, err := p.rolesByCredentialsID(ctx, tx, credentials.id)
+	prev, _, err := p.rolesByCredentialsID(ctx, tx, credentials.id)
 	if err != nil {
 		return err
 	}
@@ -356,7 +551,7 @@ func (p *postgresDatabase) UpdateCredentials(ctx context.Context, credentials *C
 		if err != nil {
 			return err
 		}
-		if err = p.createPermission(ctx, tx, credentials.id, roleID); err != nil {
+		if err = p.createPermission(ctx, tx, credentials.id, roleID, false); err != nil {
 			return err
 		}
 	}
@@ -368,6 +563,294 @@ func (p *postgresDatabase) UpdateCredentials(ctx context.Context, credentials *C
 	return nil
 }
 
+// AddRole implements Database.
+func (p *postgresDatabase) AddRole(ctx context.Context, credsID int64, role string) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	roleID, err := p.createRoleIfNotExists(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	if err = p.createPermission(ctx, tx, credsID, roleID, true); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddRoleUntil implements Database. An existing grant of the role is replaced.
+func (p *postgresDatabase) AddRoleUntil(ctx context.Context, credsID int64, role string, until time.Time) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	roleID, err := p.createRoleIfNotExists(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_permissions WHERE creds_id = $1 AND role_id = $2;`,
+		credsID, roleID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO goard_permissions (creds_id, role_id, created_at, expires_at) VALUES ($1, $2, $3, $4);`,
+		credsID, roleID, time.Now(), until,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpiredPermissions implements Database.
+func (p *postgresDatabase) DeleteExpiredPermissions(ctx context.Context) (int64, error) {
+	return deleteInBatches(ctx, p.db, p.options,
+		`DELETE FROM goard_permissions WHERE ctid IN (
+			SELECT ctid FROM goard_permissions WHERE expires_at IS NOT NULL AND expires_at <= NOW() LIMIT $1
+		);`,
+	)
+}
+
+// RemoveRole implements Database.
+func (p *postgresDatabase) RemoveRole(ctx context.Context, credsID int64, role string) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = p.deletePermission(ctx, tx, credsID, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountRole implements Database.
+func (p *postgresDatabase) CountRole(ctx context.Context, role string) (int, error) {
+	const query = `
+	SELECT
+		COUNT(DISTINCT goard_permissions.creds_id)
+	FROM
+		goard_permissions
+	JOIN
+		goard_roles
+	ON
+		goard_permissions.role_id = goard_roles.role_id
+	WHERE
+		goard_roles.role_name = $1
+	AND
+		(goard_permissions.expires_at IS NULL OR goard_permissions.expires_at > NOW());`
+
+	var count int
+	if err := p.db.QueryRowContext(ctx, query, role).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RenameRole implements Database.
+func (p *postgresDatabase) RenameRole(ctx context.Context, from, to string) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ok int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT 1 FROM goard_roles WHERE role_name = $1;`,
+		to,
+	).Scan(&ok); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	} else {
+		return ErrRoleConflict
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE goard_roles SET role_name = $1 WHERE role_name = $2;`,
+		to, from,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRole implements Database.
+func (p *postgresDatabase) DeleteRole(ctx context.Context, role string) error {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const query = `
+	DELETE FROM
+	    goard_permissions
+	USING
+	    goard_roles
+	WHERE
+	    goard_permissions.role_id = goard_roles.role_id
+	AND
+	    goard_roles.role_name = $1;`
+
+	if _, err = tx.ExecContext(ctx, query, role); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM goard_roles WHERE role_name = $1;`,
+		role,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+// ListRoles implements Database.
+func (p *postgresDatabase) ListRoles(ctx context.Context) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT role_name FROM goard_roles ORDER BY role_name;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// ForEachCredentials implements Database. Roles are not loaded.
+func (p *postgresDatabase) ForEachCredentials(ctx context.Context, callback func(*Credentials) error) error {
+	const query = `
+	SELECT
+		creds_id,
+		creds_tenant,
+		creds_login,
+		creds_passhash,
+		creds_must_change
+	FROM
+		goard_creds
+	ORDER BY
+		creds_id;`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Buffer rows so callbacks may use the database without holding this query open
+	all := []*Credentials{}
+
+	for rows.Next() {
+		creds := &Credentials{}
+		if err = rows.Scan(
+			&creds.id,
+			&creds.tenant,
+			&creds.login,
+			&creds.passhash,
+			&creds.mustChange,
+		); err != nil {
+			return err
+		}
+		all = append(all, creds)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range all {
+		if err = callback(all[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdatePasshash implements Database.
+func (p *postgresDatabase) UpdatePasshash(ctx context.Context, credsID int64, passhash string) error {
+	result, err := p.db.ExecContext(ctx,
+		`UPDATE goard_creds SET creds_passhash = $1, updated_at = $2 WHERE creds_id = $3;`,
+		passhash, time.Now(), credsID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrCredentialsNotFound
+	}
+
+	return nil
+}
+
+// SetMustChangePassword implements Database.
+func (p *postgresDatabase) SetMustChangePassword(ctx context.Context, credsID int64, must bool) error {
+	if _, err := p.db.ExecContext(ctx,
+		`UPDATE goard_creds SET creds_must_change = $1, updated_at = $2 WHERE creds_id = $3;`,
+		must, time.Now(), credsID,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func diffSlices(old, new []string) (toDelete, toAdd []string) {
 	// Создаем мапы для быстрого поиска
 	oldMap := make(map[string]struct{}, len(old))
@@ -401,7 +884,12 @@ func diffSlices(old, new []string) (toDelete, toAdd []string) {
 }
 
 func NewPostgresDatabase(db *sql.DB) Database {
+	return NewPostgresDatabaseWithOptions(db, DatabaseOptions{})
+}
+
+func NewPostgresDatabaseWithOptions(db *sql.DB, options DatabaseOptions) Database {
 	return &postgresDatabase{
-		db: db,
+		db:      db,
+		options: options.withDefaults(),
 	}
 }
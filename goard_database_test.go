@@ -0,0 +1,67 @@
+package goard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresUpdateCredentialsBindsID(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	db := NewPostgresDatabase(sqlDB)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(stmt("creds_login = $1,\n\t\tcreds_passhash = $2,\n\t\tupdated_at = $3\n\tWHERE\n\t\tcreds_id = $4")).
+		WithArgs("alice", "new-hash", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(stmt("goard_permissions.creds_id = $1")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"role_name", "expires_at"}))
+	mock.ExpectCommit()
+
+	if err := db.UpdateCredentials(context.Background(), &Credentials{
+		id:       7,
+		login:    "alice",
+		passhash: "new-hash",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresPermissions(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	db := NewPostgresDatabase(sqlDB).(PermissionDatabase)
+
+	mock.ExpectExec(stmt("INSERT INTO goard_creds_permissions (creds_id, permission, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;")).
+		WithArgs(int64(7), "posts:write", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(stmt("DELETE FROM goard_creds_permissions WHERE creds_id = $1 AND permission = $2;")).
+		WithArgs(int64(7), "posts:write").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.AddPermission(context.Background(), 7, "posts:write"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemovePermission(context.Background(), 7, "posts:write"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
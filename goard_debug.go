@@ -0,0 +1,117 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const redacted = "[REDACTED]"
+
+// DebugInfo is the effective Goard configuration, secrets are redacted
+type DebugInfo struct {
+	TTL             string            `json:"ttl"`
+	CleanupInterval string            `json:"cleanup_interval"`
+	CleanupWorkers  int               `json:"cleanup_workers"`
+	Hasher          string            `json:"hasher"`
+	HasherCost      int               `json:"hasher_cost,omitempty"`
+	Store           string            `json:"store"`
+	Container       string            `json:"container"`
+	Transport       string            `json:"transport"`
+	Validator       string            `json:"validator"`
+	Database        string            `json:"database"`
+	Locker          string            `json:"locker,omitempty"`
+	AdminLogin      string            `json:"admin_login"`
+	AdminPassword   string            `json:"admin_password"`
+	ProtectedRole   string            `json:"protected_role"`
+	MaxRoles        int               `json:"max_roles_per_account"`
+	RoleTTL         map[string]string `json:"role_ttl,omitempty"`
+	AccountRefresh  string            `json:"account_refresh"`
+	Correlation     string            `json:"correlation_header,omitempty"`
+	Flags           map[string]bool   `json:"flags"`
+	Sessions        int               `json:"sessions"`
+}
+
+func (g *Goard) debug(ctx context.Context, sessionID string) (*DebugInfo, error) {
+	if _, err := g.adminSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	admin := g.superuser()
+
+	info := &DebugInfo{
+		TTL:             g.ttl.String(),
+		CleanupInterval: g.ci.String(),
+		CleanupWorkers:  g.workers,
+		Hasher:          fmt.Sprintf("%T", g.hasher),
+		Store:           fmt.Sprintf("%T", g.store.current()),
+		Container:       fmt.Sprintf("%T", g.container),
+		Transport:       fmt.Sprintf("%T", g.transport),
+		Validator:       fmt.Sprintf("%T", g.validator),
+		Database:        fmt.Sprintf("%T", g.database),
+		AdminLogin:      admin.Login,
+		AdminPassword:   redacted,
+		ProtectedRole:   g.protectedRole,
+		MaxRoles:        g.maxRoles,
+		AccountRefresh:  g.accountRefresh.String(),
+		Correlation:     g.correlation,
+		Flags: map[string]bool{
+			"stateless":               g.stateless,
+			"allow_quarantined_reads": g.quarantineReads,
+			"json_errors":             g.jsonErrors,
+			"normalize_passwords":     g.normalize,
+			"debug_authz":             g.debugAuthz,
+			"tenants":                 g.tenant != nil,
+			"account_preprocessor":    g.preprocess != nil,
+			"audit":                   g.audit != nil,
+		},
+		Sessions: g.store.Count(ctx),
+	}
+
+	if bcrypt, ok := g.hasher.(*bcryptHasher); ok {
+		info.HasherCost = bcrypt.cost
+	}
+
+	if g.locker != nil {
+		info.Locker = fmt.Sprintf("%T", g.locker)
+	}
+
+	if len(g.roleTTL) > 0 {
+		info.RoleTTL = make(map[string]string, len(g.roleTTL))
+		for role, ttl := range g.roleTTL {
+			info.RoleTTL[role] = ttl.String()
+		}
+	}
+
+	return info, nil
+}
+
+// Debug writes the effective configuration to admin sessions
+func (g *Goard) Debug(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := g.container.GetSession(r)
+	if sessionID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	info, err := g.debug(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, ErrAccessDenied) {
+			w.WriteHeader(http.StatusForbidden)
+		} else if unauthenticated(err) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		g.logger.Warn("goard: writing response failed", "err", err)
+	}
+}
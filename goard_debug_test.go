@@ -0,0 +1,46 @@
+package goard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugRedactsSecrets(t *testing.T) {
+	container, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: HS256, Secret: []byte("jwt-signing-secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newTestGoard(t, &Config{Container: container, TTL: 2 * time.Hour, JSONErrors: true})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	h := http.HandlerFunc(g.Debug)
+	rec := serve(h, http.MethodGet, signInCookie(t, g, "root", "Root-pass-1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin: %d, want 200", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, secret := range []string{"Root-pass-1", "jwt-signing-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("debug output leaks %q", secret)
+		}
+	}
+
+	var info DebugInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.AdminPassword != redacted || info.AdminLogin != "root" {
+		t.Errorf("admin = %q / %q, want root / %s", info.AdminLogin, info.AdminPassword, redacted)
+	}
+	if info.TTL != "2h0m0s" || info.Container != "*goard.jwtContainer" || !info.Flags["json_errors"] {
+		t.Errorf("info = %+v", info)
+	}
+
+	if rec := serve(h, http.MethodGet, signInCookie(t, g, "alice", "Secret-pass-1")); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: %d, want 403", rec.Code)
+	}
+}
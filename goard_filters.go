@@ -0,0 +1,156 @@
+package goard
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Policy is a Guard filter able to describe the roles it requires
+type Policy interface {
+	Allow(*Session) bool
+	Required() []string
+}
+
+// RequestPolicy is a Policy also looking at the guarded request, e.g. its path
+type RequestPolicy interface {
+	Policy
+	AllowRequest(*Session, *http.Request) bool
+}
+
+// Filter adapts a plain filter function to a Policy with no described requirement
+type Filter func(*Session) bool
+
+func (f Filter) Allow(s *Session) bool {
+	return f(s)
+}
+
+func (f Filter) Required() []string {
+	return nil
+}
+
+type rolesPolicy []string
+
+func (p rolesPolicy) Allow(s *Session) bool {
+	for _, role := range p {
+		if !slices.Contains(s.EffectiveRoles(), role) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p rolesPolicy) Required() []string {
+	return p
+}
+
+// RolesPolicy admits sessions holding every listed role
+func RolesPolicy(roles ...string) Policy {
+	return rolesPolicy(roles)
+}
+
+type accountPolicy struct {
+	extract func(*http.Request) int64
+	admins  bool
+}
+
+func (p *accountPolicy) Allow(*Session) bool {
+	return true
+}
+
+func (p *accountPolicy) Required() []string {
+	return nil
+}
+
+func (p *accountPolicy) AllowRequest(s *Session, r *http.Request) bool {
+	if p.admins && s.IsAdmin() {
+		return true
+	}
+
+	id := p.extract(r)
+	return id != 0 && s.Account() != nil && s.Account().GetID() == id
+}
+
+// AccountOption customizes RequireAccount
+type AccountOption func(*accountPolicy)
+
+// WithoutAdminBypass holds admins to their own account as well
+func WithoutAdminBypass() AccountOption {
+	return func(p *accountPolicy) {
+		p.admins = false
+	}
+}
+
+// RequireAccount admits sessions whose account is the one extract reads from
+// the request, e.g. the {id} of /accounts/{id}/settings, so one account can't
+// reach another's resources. extract returns 0 for requests naming no valid
+// account, which are refused. Admins pass unless WithoutAdminBypass is given.
+func RequireAccount(extract func(*http.Request) int64, options ...AccountOption) Policy {
+	p := &accountPolicy{extract: extract, admins: true}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Guard filters receive the resolved session and report whether it may pass.
+// A session without roles yields a nil (or empty) Roles() slice: role checks
+// such as slices.Contains fail for it, while filters ignoring roles let it in.
+
+// RequireNonEmptyRoles rejects sessions holding no roles at all, e.g. accounts
+// that are not onboarded yet
+func RequireNonEmptyRoles() func(*Session) bool {
+	return func(s *Session) bool {
+		return len(s.Roles()) > 0
+	}
+}
+
+// RequireAllRoles admits sessions holding every listed role, all sessions when
+// none are listed
+func RequireAllRoles(roles ...string) func(*Session) bool {
+	return rolesPolicy(roles).Allow
+}
+
+// RequireRole is RequireAllRoles, reading better for a single role
+func RequireRole(roles ...string) func(*Session) bool {
+	return RequireAllRoles(roles...)
+}
+
+// RequireAnyRole admits sessions holding at least one listed role, none when
+// none are listed
+func RequireAnyRole(roles ...string) func(*Session) bool {
+	return func(s *Session) bool {
+		for _, role := range roles {
+			if slices.Contains(s.EffectiveRoles(), role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RequireScope admits sessions having every listed scope, see Session.HasScope
+func RequireScope(scopes ...string) func(*Session) bool {
+	return func(s *Session) bool {
+		for _, scope := range scopes {
+			if !s.HasScope(scope) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// RequirePermission admits sessions whose account holds the fine grained
+// permission, and superuser sessions
+func RequirePermission(permission string) func(*Session) bool {
+	return func(s *Session) bool {
+		return s.IsAdmin() || slices.Contains(s.Permissions(), permission)
+	}
+}
+
+// RequireAdmin admits superuser sessions only
+func RequireAdmin() func(*Session) bool {
+	return func(s *Session) bool {
+		return s.IsAdmin()
+	}
+}
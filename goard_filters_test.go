@@ -0,0 +1,156 @@
+package goard
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// okHandler is a guarded handler answering 200
+var okHandler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+func TestRequireNonEmptyRoles(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	bob := signUpAccount(t, g, "bob", "Secret-pass-1")
+	if err := g.database.AddRole(context.Background(), bob, "viewer"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := g.Guard(okHandler, RequireNonEmptyRoles())
+
+	if rec := serve(h, http.MethodGet, signInCookie(t, g, "alice", "Secret-pass-1")); rec.Code != http.StatusForbidden {
+		t.Fatalf("no roles: %d, want 403", rec.Code)
+	}
+	if rec := serve(h, http.MethodGet, signInCookie(t, g, "bob", "Secret-pass-1")); rec.Code != http.StatusOK {
+		t.Fatalf("with a role: %d, want 200", rec.Code)
+	}
+}
+
+func TestRequireAccount(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	alice := signUpAccount(t, g, "alice", "Secret-pass-1")
+	bob := signUpAccount(t, g, "bob", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+	admin := signInCookie(t, g, "root", "Root-pass-1")
+
+	pathID := func(r *http.Request) int64 {
+		id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		return id
+	}
+	settings := func(options ...AccountOption) http.Handler {
+		mux := http.NewServeMux()
+		mux.Handle("/accounts/{id}/settings", g.GuardPolicy(okHandler, RequireAccount(pathID, options...)))
+		return mux
+	}
+	get := func(h http.Handler, cookie *http.Cookie, path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	h := settings()
+	for _, tc := range []struct {
+		name   string
+		cookie *http.Cookie
+		path   string
+		want   int
+	}{
+		{"own account", cookie, "/accounts/" + strconv.FormatInt(alice, 10) + "/settings", http.StatusOK},
+		{"other account", cookie, "/accounts/" + strconv.FormatInt(bob, 10) + "/settings", http.StatusForbidden},
+		{"no account", cookie, "/accounts/me/settings", http.StatusForbidden},
+		{"admin bypass", admin, "/accounts/" + strconv.FormatInt(bob, 10) + "/settings", http.StatusOK},
+	} {
+		if got := get(h, tc.cookie, tc.path); got != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if got := get(settings(WithoutAdminBypass()), admin, "/accounts/"+strconv.FormatInt(bob, 10)+"/settings"); got != http.StatusForbidden {
+		t.Errorf("admin WithoutAdminBypass: %d, want 403", got)
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	none := &Session{credentials: &Credentials{}}
+	editor := &Session{credentials: &Credentials{roles: []string{"editor"}}}
+	both := &Session{credentials: &Credentials{roles: []string{"editor", "viewer"}}}
+	admin := &Session{credentials: &Credentials{}, admin: true}
+
+	for _, tc := range []struct {
+		name   string
+		filter func(*Session) bool
+		want   [4]bool // none, editor, both, admin
+	}{
+		{"RequireRole()", RequireRole(), [4]bool{true, true, true, true}},
+		{"RequireRole(editor)", RequireRole("editor"), [4]bool{false, true, true, false}},
+		{"RequireAllRoles()", RequireAllRoles(), [4]bool{true, true, true, true}},
+		{"RequireAllRoles(editor, viewer)", RequireAllRoles("editor", "viewer"), [4]bool{false, false, true, false}},
+		{"RequireAnyRole()", RequireAnyRole(), [4]bool{false, false, false, false}},
+		{"RequireAnyRole(viewer)", RequireAnyRole("viewer"), [4]bool{false, false, true, false}},
+		{"RequireAnyRole(editor, viewer)", RequireAnyRole("editor", "viewer"), [4]bool{false, true, true, false}},
+		{"RequireAdmin()", RequireAdmin(), [4]bool{false, false, false, true}},
+	} {
+		for i, session := range []*Session{none, editor, both, admin} {
+			if got := tc.filter(session); got != tc.want[i] {
+				t.Errorf("%s with roles %v (admin %v) = %v, want %v", tc.name, session.Roles(), session.IsAdmin(), got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ctx := context.Background()
+	app, db := &testApp{}, newTestDatabase(t)
+	scopes := map[string][]string{"read": nil, "write": {"editor"}}
+	g := newTestGoard(t, &Config{App: app, Database: db, Scopes: scopes})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	signIn := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, request(http.MethodPost, body))
+		return rec
+	}
+
+	// write is allowed to editors only
+	if rec := signIn(`{"login":"alice","password":"Secret-pass-1","scopes":["write"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("SignIn for a denied scope = %d, want 403", rec.Code)
+	}
+
+	rec := signIn(`{"login":"alice","password":"Secret-pass-1","scopes":["read"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SignIn = %d, want 200", rec.Code)
+	}
+	readOnly := sessionCookie(t, rec)
+	unlimited := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	reads := g.Guard(okHandler, RequireScope("read"))
+	writes := g.Guard(okHandler, RequireScope("write"))
+	if rec := serve(reads, http.MethodGet, readOnly); rec.Code != http.StatusOK {
+		t.Fatalf("read-only session reading: %d, want 200", rec.Code)
+	}
+	if rec := serve(writes, http.MethodPost, readOnly); rec.Code != http.StatusForbidden {
+		t.Fatalf("read-only session writing: %d, want 403", rec.Code)
+	}
+	if rec := serve(writes, http.MethodPost, unlimited); rec.Code != http.StatusOK {
+		t.Fatalf("unscoped session writing: %d, want 200", rec.Code)
+	}
+
+	// Scopes survive a snapshot
+	var snapshot bytes.Buffer
+	if err := g.DrainTo(ctx, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	after := newTestGoard(t, &Config{App: app, Database: db, Scopes: scopes})
+	if err := after.LoadFrom(ctx, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(after.Guard(okHandler, RequireScope("write")), http.MethodPost, readOnly); rec.Code != http.StatusForbidden {
+		t.Fatalf("restored read-only session writing: %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,240 @@
+package goard
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type formTransport struct {
+	config transportConfig
+}
+
+// defaultMaxMemory is the multipart/form-data memory cap, see WithMaxMemory
+const defaultMaxMemory = 32 << 20
+
+// form parses the request body, url-encoded or multipart, after checking its
+// method. URL query values are left out, passwords must not end up in access logs.
+func (t *formTransport) form(r *http.Request, op Operation) (url.Values, error) {
+	if err := t.config.allow(r, op); err != nil {
+		return nil, err
+	}
+
+	if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media == "multipart/form-data" {
+		maxMemory := t.config.maxMemory
+		if maxMemory <= 0 {
+			maxMemory = defaultMaxMemory
+		}
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, err
+		}
+		// Only sign ups hand files on, see UploadsFromContext
+		if op != OpSignUp {
+			if err := r.MultipartForm.RemoveAll(); err != nil {
+				return nil, err
+			}
+		}
+		return url.Values(r.MultipartForm.Value), nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.PostForm, nil
+}
+
+// upload describes a multipart file to App.CreateAccount, which reads the
+// content through UploadsFromContext
+type upload struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+func (t *formTransport) account(form url.Values) (int64, error) {
+	return strconv.ParseInt(form.Get("account"), 10, 64)
+}
+
+func (t *formTransport) SignIn(r *http.Request) (login, password string, err error) {
+	login, password, _, err = t.SignInScoped(r)
+	return login, password, err
+}
+
+// SignInScoped implements ScopedTransport, reading repeated "scopes" fields
+func (t *formTransport) SignInScoped(r *http.Request) (login, password string, scopes []string, err error) {
+	form, err := t.form(r, OpSignIn)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return form.Get("login"), form.Get("password"), form["scopes"], nil
+}
+
+// SignUp passes the fields other than login and password to App.CreateAccount
+// as a JSON object, fields sent once as strings and repeated ones as arrays.
+// Multipart files are passed as {"filename", "size", "content_type"} objects,
+// their content through UploadsFromContext.
+func (t *formTransport) SignUp(r *http.Request) (account json.RawMessage, login, password string, err error) {
+	form, err := t.form(r, OpSignUp)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	fields := make(map[string]any, len(form))
+	for key, values := range form {
+		if key == "login" || key == "password" {
+			continue
+		}
+		if len(values) == 1 {
+			fields[key] = values[0]
+		} else {
+			fields[key] = values
+		}
+	}
+
+	if r.MultipartForm != nil {
+		for key, headers := range r.MultipartForm.File {
+			uploads := make([]upload, 0, len(headers))
+			for _, header := range headers {
+				uploads = append(uploads, upload{
+					Filename:    header.Filename,
+					Size:        header.Size,
+					ContentType: header.Header.Get("Content-Type"),
+				})
+			}
+			if len(uploads) == 1 {
+				fields[key] = uploads[0]
+			} else {
+				fields[key] = uploads
+			}
+		}
+	}
+
+	if account, err = json.Marshal(fields); err != nil {
+		return nil, "", "", err
+	}
+	return account, form.Get("login"), form.Get("password"), nil
+}
+
+func (t *formTransport) SetRole(r *http.Request) (account int64, role string, err error) {
+	return t.grant(r, OpSetRole, "role")
+}
+
+func (t *formTransport) UnsetRole(r *http.Request) (account int64, role string, err error) {
+	return t.grant(r, OpUnsetRole, "role")
+}
+
+// SetPermission implements PermissionTransport.
+func (t *formTransport) SetPermission(r *http.Request) (account int64, permission string, err error) {
+	return t.grant(r, OpSetPermission, "permission")
+}
+
+// UnsetPermission implements PermissionTransport.
+func (t *formTransport) UnsetPermission(r *http.Request) (account int64, permission string, err error) {
+	return t.grant(r, OpUnsetPermission, "permission")
+}
+
+// grant reads the account and the named role or permission field
+func (t *formTransport) grant(r *http.Request, op Operation, field string) (account int64, value string, err error) {
+	form, err := t.form(r, op)
+	if err != nil {
+		return 0, "", err
+	}
+	if account, err = t.account(form); err != nil {
+		return 0, "", err
+	}
+	return account, form.Get(field), nil
+}
+
+// Offboard implements OffboardTransport, reading account
+func (t *formTransport) Offboard(r *http.Request) (account int64, err error) {
+	form, err := t.form(r, OpOffboard)
+	if err != nil {
+		return 0, err
+	}
+	return t.account(form)
+}
+
+// VerifyPassword implements VerifyTransport, reading password
+func (t *formTransport) VerifyPassword(r *http.Request) (password string, err error) {
+	form, err := t.form(r, OpVerify)
+	if err != nil {
+		return "", err
+	}
+	return form.Get("password"), nil
+}
+
+// ChangePassword implements PasswordTransport, reading current_password and password
+func (t *formTransport) ChangePassword(r *http.Request) (current, password string, err error) {
+	form, err := t.form(r, OpChangePassword)
+	if err != nil {
+		return "", "", err
+	}
+	return form.Get("current_password"), form.Get("password"), nil
+}
+
+// RequestUnlock implements UnlockTransport, reading login
+func (t *formTransport) RequestUnlock(r *http.Request) (login string, err error) {
+	form, err := t.form(r, OpRequestUnlock)
+	if err != nil {
+		return "", err
+	}
+	return form.Get("login"), nil
+}
+
+// Unlock implements UnlockTransport, reading token
+func (t *formTransport) Unlock(r *http.Request) (token string, err error) {
+	form, err := t.form(r, OpUnlock)
+	if err != nil {
+		return "", err
+	}
+	return form.Get("token"), nil
+}
+
+// CheckPermissions implements CheckTransport, reading repeated "permissions" fields
+func (t *formTransport) CheckPermissions(r *http.Request) (permissions []string, err error) {
+	form, err := t.form(r, OpCheck)
+	if err != nil {
+		return nil, err
+	}
+	return form["permissions"], nil
+}
+
+// WriteSignIn implements SignInWriter, answering 200 with a form encoded session_id and expires_at,
+// adding must_change_password=true for flagged accounts
+func (t *formTransport) WriteSignIn(w http.ResponseWriter, session *Session) error {
+	values := url.Values{
+		"session_id": {session.id},
+		"expires_at": {session.exp.Format(time.RFC3339)},
+	}
+	if session.MustChangePassword() {
+		values.Set("must_change_password", "true")
+	}
+
+	w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte(values.Encode()))
+	return err
+}
+
+// NewFormTransport reads application/x-www-form-urlencoded and
+// multipart/form-data bodies (login, password, account, role, ...) as posted
+// by HTML forms. Forms can't send other methods, so every operation accepts
+// POST unless WithMethods says otherwise. WithJSONPath and WithAccountPath
+// don't apply.
+func NewFormTransport(options ...TransportOption) Transport {
+	t := &formTransport{
+		config: transportConfig{
+			methods: make(map[Operation]string, len(defaultMethods)),
+		},
+	}
+	for op := range defaultMethods {
+		t.config.methods[op] = http.MethodPost
+	}
+	for _, option := range options {
+		option(&t.config)
+	}
+	return t
+}
@@ -0,0 +1,171 @@
+package goard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// formRequest sends url-encoded values
+func formRequest(method string, values url.Values) *http.Request {
+	r := httptest.NewRequest(method, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestFormTransport(t *testing.T) {
+	transport := NewFormTransport()
+
+	// Query values are ignored, only the body counts
+	r := formRequest(http.MethodPost, url.Values{"login": {"alice"}, "password": {"Secret-pass-1"}})
+	r.URL.RawQuery = "login=mallory"
+	login, password, err := transport.SignIn(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "alice" || password != "Secret-pass-1" {
+		t.Fatalf("SignIn = %q %q, want alice Secret-pass-1", login, password)
+	}
+
+	account, login, password, err := transport.SignUp(formRequest(http.MethodPost, url.Values{
+		"login":    {"alice"},
+		"password": {"Secret-pass-1"},
+		"name":     {"Alice"},
+		"tags":     {"a", "b"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "alice" || password != "Secret-pass-1" {
+		t.Fatalf("SignUp = %q %q, want alice Secret-pass-1", login, password)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(account, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 || fields["name"] != "Alice" || len(fields["tags"].([]any)) != 2 {
+		t.Fatalf("account = %s, want name and tags only", account)
+	}
+
+	id, role, err := transport.SetRole(formRequest(http.MethodPost, url.Values{"account": {"7"}, "role": {"editor"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 || role != "editor" {
+		t.Fatalf("SetRole = %d %q, want 7 editor", id, role)
+	}
+	if _, _, err := transport.UnsetRole(formRequest(http.MethodPost, url.Values{"account": {"seven"}, "role": {"editor"}})); err == nil {
+		t.Fatal("UnsetRole accepted a non numeric account")
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		_, _, err := transport.SignIn(formRequest(method, url.Values{"login": {"alice"}, "password": {"Secret-pass-1"}}))
+		if !errors.Is(err, ErrMethod) {
+			t.Fatalf("SignIn over %s = %v, want ErrMethod", method, err)
+		}
+	}
+}
+
+func TestFormTransportSignIn(t *testing.T) {
+	g := newTestGoard(t, &Config{Transport: NewFormTransport()})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, formRequest(http.MethodPost, url.Values{"login": {"alice"}, "password": {"Secret-pass-1"}}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SignIn = %d, want 200", rec.Code)
+	}
+	if cookieSession(g, sessionCookie(t, rec)) == "" {
+		t.Fatal("SignIn set no session")
+	}
+
+	rec = httptest.NewRecorder()
+	g.SignIn(rec, formRequest(http.MethodGet, url.Values{"login": {"alice"}, "password": {"Secret-pass-1"}}))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("SignIn over GET = %d, Allow %q, want 405 POST", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+// avatarApp reads the avatar uploaded with a sign up
+type avatarApp struct {
+	*testApp
+	avatar []byte
+}
+
+func (a *avatarApp) CreateAccount(ctx context.Context, raw json.RawMessage) (Account, error) {
+	uploads, ok := UploadsFromContext(ctx)
+	if !ok || len(uploads["avatar"]) != 1 {
+		return nil, errors.New("no avatar")
+	}
+	file, err := uploads["avatar"][0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if a.avatar, err = io.ReadAll(file); err != nil {
+		return nil, err
+	}
+	return a.testApp.CreateAccount(ctx, raw)
+}
+
+func TestFormTransportMultipartSignUp(t *testing.T) {
+	avatar := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 256)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, field := range [][2]string{{"login", "alice"}, {"password", "Secret-pass-1"}, {"name", "Alice"}} {
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="avatar"; filename="me.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(avatar)
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A small memory cap spills the file to disk, it reads the same
+	app := &avatarApp{testApp: &testApp{}}
+	g := newTestGoard(t, &Config{App: app, Transport: NewFormTransport(WithMaxMemory(64))})
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	g.SignUp(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SignUp = %d, want 200", rec.Code)
+	}
+
+	var account struct {
+		Name   string `json:"name"`
+		Avatar upload `json:"avatar"`
+	}
+	if err := json.Unmarshal(app.accounts[1], &account); err != nil {
+		t.Fatal(err)
+	}
+	want := upload{Filename: "me.png", Size: int64(len(avatar)), ContentType: "image/png"}
+	if account.Name != "Alice" || account.Avatar != want {
+		t.Fatalf("account = %s, want the name and the avatar metadata", app.accounts[1])
+	}
+	if !bytes.Equal(app.avatar, avatar) {
+		t.Fatalf("App read %d avatar bytes, want %d", len(app.avatar), len(avatar))
+	}
+	if _, err := g.AuthenticatePassword(context.Background(), "alice", "Secret-pass-1"); err != nil {
+		t.Fatalf("credentials from the multipart fields: %v", err)
+	}
+}
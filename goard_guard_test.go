@@ -0,0 +1,432 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOptional(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	var session *Session
+	var found bool
+	h := g.Optional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, found = SessionFromContext(r.Context())
+	}))
+
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("signed in: %d, want 200", rec.Code)
+	}
+	if !found || session.ID() != cookieSession(g, cookie) {
+		t.Fatal("signed in: handler got no session")
+	}
+
+	if rec := serve(h, http.MethodGet, nil); rec.Code != http.StatusOK {
+		t.Fatalf("anonymous: %d, want 200", rec.Code)
+	}
+	if found {
+		t.Fatal("anonymous: handler got a session")
+	}
+}
+
+func TestRevokeAllRejectedByGuard(t *testing.T) {
+	g := newTestGoard(t, &Config{RefreshTTL: time.Hour})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	signUpAccount(t, g, "bob", "Secret-pass-1")
+
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+	_, token := signInRefresh(t, g, "bob", "Secret-pass-1")
+	admin := signInCookie(t, g, "root", "Root-pass-1")
+
+	h := g.Guard(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), func(*Session) bool { return true })
+	for _, cookie := range []*http.Cookie{alice, admin} {
+		if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+			t.Fatalf("before RevokeAll: %d, want 200", rec.Code)
+		}
+	}
+
+	if err := g.RevokeAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cookie := range []*http.Cookie{alice, admin} {
+		if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("after RevokeAll: %d, want 401", rec.Code)
+		}
+	}
+	if rec := trade(g, token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after RevokeAll: %d, want 401", rec.Code)
+	}
+
+	// Stateless tokens skip the store, two instances share only the database and the epoch
+	database, epochs := newTestDatabase(t), NewEpochStore()
+	instance := func() *Goard {
+		container, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: HS256, Secret: []byte("secret")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newTestGoard(t, &Config{Container: container, Database: database, EpochStore: epochs, Stateless: true})
+	}
+	first, second := instance(), instance()
+	signUpAccount(t, first, "carol", "Secret-pass-1")
+	carol := signInCookie(t, first, "carol", "Secret-pass-1")
+
+	guards := []http.Handler{
+		first.Guard(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), func(*Session) bool { return true }),
+		second.Guard(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), func(*Session) bool { return true }),
+	}
+	for _, h := range guards {
+		if rec := serve(h, http.MethodGet, carol); rec.Code != http.StatusOK {
+			t.Fatalf("stateless before RevokeAll: %d, want 200", rec.Code)
+		}
+	}
+
+	if err := second.RevokeAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range guards {
+		if rec := serve(h, http.MethodGet, carol); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("stateless after RevokeAll: %d, want 401", rec.Code)
+		}
+	}
+	if rec := serve(guards[0], http.MethodGet, signInCookie(t, first, "carol", "Secret-pass-1")); rec.Code != http.StatusOK {
+		t.Fatalf("stateless signed in after RevokeAll: %d, want 200", rec.Code)
+	}
+}
+
+func TestGuardPropagatesIdentity(t *testing.T) {
+	g := newTestGoard(t, &Config{CorrelationHeader: "X-Correlation-ID"})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	var sessionID string
+	var accountID int64
+	h := g.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID, _ = SessionIDFromContext(r.Context())
+		accountID, _ = AccountIDFromContext(r.Context())
+	}), func(*Session) bool { return true })
+
+	rec := serve(h, http.MethodGet, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Guard = %d, want 200", rec.Code)
+	}
+
+	id := cookieSession(g, cookie)
+	if sessionID != id || accountID != account {
+		t.Fatalf("context = %q %d, want %q %d", sessionID, accountID, id, account)
+	}
+	if got := rec.Header().Get("X-Correlation-ID"); got != CorrelationID(id) || got == id {
+		t.Fatalf("correlation header = %q, want %q", got, CorrelationID(id))
+	}
+}
+
+func TestGuardSessionFromContext(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	if err := g.database.AddRole(context.Background(), account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	var session *Session
+	var found bool
+	h := g.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, found = SessionFromContext(r.Context())
+	}), RequireRole("editor"))
+
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("Guard = %d, want 200", rec.Code)
+	}
+	if !found {
+		t.Fatal("guarded handler found no session")
+	}
+	if session.ID() != cookieSession(g, cookie) || session.Account().GetID() != account {
+		t.Fatalf("session = %q of account %d, want %q of %d", session.ID(), session.Account().GetID(), cookieSession(g, cookie), account)
+	}
+	if !slices.Equal(session.Roles(), []string{"editor"}) {
+		t.Fatalf("roles = %v, want [editor]", session.Roles())
+	}
+
+	if _, ok := SessionFromContext(context.Background()); ok {
+		t.Fatal("session found in an unguarded context")
+	}
+}
+
+func TestGuardBlocksQuarantinedSessions(t *testing.T) {
+	ctx := context.Background()
+	allowAll := func(*Session) bool { return true }
+
+	for _, reads := range []bool{false, true} {
+		g := newTestGoard(t, &Config{AllowQuarantinedReads: reads})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+		cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+		if err := g.SetSessionState(ctx, cookieSession(g, cookie), SessionQuarantined); err != nil {
+			t.Fatal(err)
+		}
+
+		h := g.Guard(okHandler, allowAll)
+		if rec := serve(h, http.MethodPost, cookie); rec.Code != http.StatusForbidden {
+			t.Fatalf("reads %v: POST = %d, want 403", reads, rec.Code)
+		}
+
+		want := http.StatusForbidden
+		if reads {
+			want = http.StatusOK
+		}
+		if rec := serve(h, http.MethodGet, cookie); rec.Code != want {
+			t.Fatalf("reads %v: GET = %d, want %d", reads, rec.Code, want)
+		}
+
+		if err := g.SetSessionState(ctx, cookieSession(g, cookie), SessionActive); err != nil {
+			t.Fatal(err)
+		}
+		if rec := serve(h, http.MethodPost, cookie); rec.Code != http.StatusOK {
+			t.Fatalf("reactivated: POST = %d, want 200", rec.Code)
+		}
+	}
+}
+
+func TestGuardStatusQuadrants(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	valid := signInCookie(t, g, "alice", "Secret-pass-1")
+	revoked := signInCookie(t, g, "alice", "Secret-pass-1")
+	if err := g.SetSessionState(ctx, cookieSession(g, revoked), SessionRevoked); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := &Session{
+		id:          "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b",
+		credentials: &Credentials{id: 1},
+		iss:         time.Now().Add(-2 * time.Hour),
+		exp:         time.Now().Add(-time.Hour),
+	}
+	if err := g.store.CreateSession(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	g.container.SetSession(rec, stale)
+	expired := sessionCookie(t, rec)
+
+	allow := g.Guard(okHandler, func(*Session) bool { return true })
+	deny := g.Guard(okHandler, func(*Session) bool { return false })
+
+	for _, tc := range []struct {
+		name   string
+		cookie *http.Cookie
+		allow  int
+		deny   int
+	}{
+		{"missing", nil, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"expired", expired, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"revoked", revoked, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"valid", valid, http.StatusOK, http.StatusForbidden},
+	} {
+		if rec := serve(allow, http.MethodGet, tc.cookie); rec.Code != tc.allow {
+			t.Errorf("%s session, passing filter: %d, want %d", tc.name, rec.Code, tc.allow)
+		}
+		if rec := serve(deny, http.MethodGet, tc.cookie); rec.Code != tc.deny {
+			t.Errorf("%s session, failing filter: %d, want %d", tc.name, rec.Code, tc.deny)
+		}
+	}
+}
+
+func TestDebugAuthz(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		g := newTestGoard(t, &Config{DebugAuthz: debug})
+		bob := signUpAccount(t, g, "bob", "Secret-pass-1")
+		if err := g.database.AddRole(context.Background(), bob, "viewer"); err != nil {
+			t.Fatal(err)
+		}
+
+		h := g.GuardPolicy(okHandler, RolesPolicy("viewer", "editor"))
+		rec := serve(h, http.MethodGet, signInCookie(t, g, "bob", "Secret-pass-1"))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("debug %v: %d, want 403", debug, rec.Code)
+		}
+
+		if !debug {
+			if rec.Body.Len() != 0 {
+				t.Fatalf("denial body %q without DebugAuthz", rec.Body.String())
+			}
+			continue
+		}
+
+		var body map[string][]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(body["required"], []string{"viewer", "editor"}) ||
+			!slices.Equal(body["held"], []string{"viewer"}) ||
+			!slices.Equal(body["missing"], []string{"editor"}) {
+			t.Fatalf("denial body = %v", body)
+		}
+	}
+}
+
+func TestGuardJSONErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{JSONErrors: true})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	revoked := signInCookie(t, g, "alice", "Secret-pass-1")
+	session, err := g.Authorize(ctx, cookieSession(g, revoked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.revoke(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := &Session{
+		id:          "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b",
+		credentials: &Credentials{id: 1},
+		iss:         time.Now().Add(-2 * time.Hour),
+		exp:         time.Now().Add(-time.Hour),
+	}
+	if err := g.store.CreateSession(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	g.container.SetSession(rec, stale)
+	expired := sessionCookie(t, rec)
+
+	h := g.Guard(okHandler, func(*Session) bool { return true })
+	for _, tc := range []struct {
+		name   string
+		cookie *http.Cookie
+		code   string
+	}{
+		{"missing", nil, "unauthenticated"},
+		{"expired", expired, "session_expired"},
+		{"revoked", revoked, "session_revoked"},
+	} {
+		rec := serve(h, http.MethodGet, tc.cookie)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: %d, want 401", tc.name, rec.Code)
+		}
+
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if body.Code != tc.code {
+			t.Errorf("%s: code %q, want %q", tc.name, body.Code, tc.code)
+		}
+	}
+}
+
+func TestGuardMethods(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	h := g.GuardMethods(okHandler, []string{http.MethodGet, http.MethodHead}, func(*Session) bool { return true })
+
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("GET = %d, want 200", rec.Code)
+	}
+
+	// The method is checked before the session, anonymous requests get a 405 too
+	for _, c := range []*http.Cookie{cookie, nil} {
+		rec := serve(h, http.MethodDelete, c)
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("DELETE = %d, want 405", rec.Code)
+		}
+		if allow := rec.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Fatalf("Allow = %q, want \"GET, HEAD\"", allow)
+		}
+	}
+}
+
+func TestExposeExpiry(t *testing.T) {
+	for _, expose := range []bool{false, true} {
+		g := newTestGoard(t, &Config{TTL: time.Hour, ExposeExpiry: expose})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+
+		rec := serve(g.Guard(okHandler, func(*Session) bool { return true }), http.MethodGet, signInCookie(t, g, "alice", "Secret-pass-1"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Guard = %d, want 200", rec.Code)
+		}
+
+		header := rec.Header().Get(ExpiresInHeader)
+		if !expose {
+			if header != "" {
+				t.Fatalf("%s = %q without ExposeExpiry", ExpiresInHeader, header)
+			}
+			continue
+		}
+
+		seconds, err := strconv.Atoi(header)
+		if err != nil {
+			t.Fatalf("%s = %q: %v", ExpiresInHeader, header, err)
+		}
+		if seconds < 3590 || seconds > 3600 {
+			t.Fatalf("%s = %d, want about 3600", ExpiresInHeader, seconds)
+		}
+	}
+}
+
+func TestExpiryGrace(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{ExpiryGrace: time.Minute})
+	h := g.Guard(okHandler, func(*Session) bool { return true })
+
+	expiredFor := func(id string, ago time.Duration) *http.Cookie {
+		t.Helper()
+		session := &Session{
+			id:          id,
+			credentials: &Credentials{id: 1},
+			iss:         time.Now().Add(-time.Hour),
+			exp:         time.Now().Add(-ago),
+		}
+		if err := g.store.CreateSession(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		g.container.SetSession(rec, session)
+		return sessionCookie(t, rec)
+	}
+
+	inside := expiredFor("9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b", 10*time.Second)
+	rec := serve(h, http.MethodGet, inside)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("inside the grace: %d, want 200", rec.Code)
+	}
+	if rec.Header().Get(ExpiringHeader) == "" {
+		t.Fatalf("inside the grace: no %s header", ExpiringHeader)
+	}
+
+	outside := expiredFor("0c1d2e3f-4a5b-4c6d-8e7f-8091a2b3c4d5", 2*time.Minute)
+	if rec := serve(h, http.MethodGet, outside); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("outside the grace: %d, want 401", rec.Code)
+	}
+
+	// Cleanup waits out the grace too
+	if err := g.sweep(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.store.InvokeSession(ctx, "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b"); err != nil {
+		t.Fatalf("session inside the grace swept: %v", err)
+	}
+	if err := g.sweep(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.store.Count(ctx); n != 0 {
+		t.Fatalf("%d sessions left past the grace", n)
+	}
+}
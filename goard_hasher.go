@@ -2,7 +2,18 @@ package goard
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -10,19 +21,64 @@ type bcryptHasher struct {
 	cost int
 }
 
+type bcryptResult struct {
+	hash []byte
+	err  error
+}
+
+// Hash returns ctx.Err() as soon as ctx is done. The bcrypt work itself
+// cannot be interrupted and finishes in the background.
 func (b *bcryptHasher) Hash(ctx context.Context, password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
-	return string(hash), nil
+
+	result := make(chan bcryptResult, 1)
+	go func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+		result <- bcryptResult{hash: hash, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-result:
+		if res.err != nil {
+			return "", res.err
+		}
+		return string(res.hash), nil
+	}
 }
 
+// Compare reports a mismatch as soon as ctx is done
 func (b *bcryptHasher) Compare(ctx context.Context, hash, password string) bool {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}()
+
+	select {
+	case <-ctx.Done():
 		return false
+	case err := <-result:
+		return err == nil
+	}
+}
+
+func (b *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
 	}
-	return true
+	return cost < b.cost
+}
+
+func (b *bcryptHasher) hashPrefix() string {
+	return PrefixBcrypt
 }
 
 func NewBcryptHasher(cost int) Hasher {
@@ -30,3 +86,301 @@ func NewBcryptHasher(cost int) Hasher {
 		cost: cost,
 	}
 }
+
+const fastPrefix = "$fast$"
+
+// fastHasher is a salted single-round SHA-256, fit for tests only
+type fastHasher struct {
+	unsafe bool
+}
+
+func (f *fastHasher) Hash(_ context.Context, password string) (string, error) {
+	if !f.unsafe {
+		return "", ErrUnsafeHasher
+	}
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(salt, password...))
+	return fastPrefix + hex.EncodeToString(salt) + "$" + hex.EncodeToString(sum[:]), nil
+}
+
+func (f *fastHasher) hashPrefix() string {
+	return fastPrefix
+}
+
+func (f *fastHasher) Compare(_ context.Context, hash, password string) bool {
+	if !f.unsafe {
+		return false
+	}
+	encoded, digest, ok := strings.Cut(strings.TrimPrefix(hash, fastPrefix), "$")
+	if !ok {
+		return false
+	}
+	salt, err := hex.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(append(salt, password...))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(digest)) == 1
+}
+
+// NewFastTestHasher returns a trivial Hasher to keep test suites fast.
+// NEVER use it in production: it refuses to hash until unsafe is true.
+func NewFastTestHasher(unsafe bool) Hasher {
+	if unsafe {
+		slog.Warn("goard: insecure fast test hasher enabled, do not use in production")
+	}
+	return &fastHasher{
+		unsafe: unsafe,
+	}
+}
+
+// Argon2Params tunes the Argon2id hasher, zero fields take the defaults
+type Argon2Params struct {
+	// Memory - is memory cost in KiB, 64 MiB by default
+	Memory uint32
+	// Iterations - is time cost, 3 by default
+	Iterations uint32
+	// Parallelism - is number of lanes, 4 by default
+	Parallelism uint8
+	// SaltLength - is random salt size in bytes, 16 by default
+	SaltLength uint32
+	// KeyLength - is derived key size in bytes, 32 by default
+	KeyLength uint32
+}
+
+type argon2Hasher struct {
+	params Argon2Params
+}
+
+// Hash returns the PHC string $argon2id$v=19$m=...,t=...,p=...$salt$hash
+func (a *argon2Hasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	result := make(chan []byte, 1)
+	go func() {
+		result <- argon2.IDKey([]byte(password), salt,
+			a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength,
+		)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case key := <-result:
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+			PrefixArgon2id, argon2.Version,
+			a.params.Memory, a.params.Iterations, a.params.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	}
+}
+
+// Compare reports malformed hashes and a done ctx as a mismatch
+func (a *argon2Hasher) Compare(ctx context.Context, hash, password string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	params, salt, key, ok := parseArgon2(hash)
+	if !ok {
+		return false
+	}
+
+	result := make(chan []byte, 1)
+	go func() {
+		result <- argon2.IDKey([]byte(password), salt,
+			params.Iterations, params.Memory, params.Parallelism, uint32(len(key)),
+		)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case derived := <-result:
+		return subtle.ConstantTimeCompare(derived, key) == 1
+	}
+}
+
+func (a *argon2Hasher) NeedsRehash(hash string) bool {
+	params, salt, key, ok := parseArgon2(hash)
+	if !ok {
+		return true
+	}
+	return params.Memory < a.params.Memory ||
+		params.Iterations < a.params.Iterations ||
+		params.Parallelism != a.params.Parallelism ||
+		uint32(len(salt)) < a.params.SaltLength ||
+		uint32(len(key)) < a.params.KeyLength
+}
+
+func (a *argon2Hasher) hashPrefix() string {
+	return PrefixArgon2id
+}
+
+func parseArgon2(hash string) (params Argon2Params, salt, key []byte, ok bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || "$"+parts[1]+"$" != PrefixArgon2id {
+		return params, nil, nil, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, false
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Iterations, &params.Parallelism,
+	); err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, false
+	}
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, false
+	}
+
+	return params, salt, key, true
+}
+
+func NewArgon2Hasher(params Argon2Params) Hasher {
+	if params.Memory == 0 {
+		params.Memory = 64 * 1024
+	}
+	if params.Iterations == 0 {
+		params.Iterations = 3
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = 4
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = 16
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = 32
+	}
+	return &argon2Hasher{
+		params: params,
+	}
+}
+
+// Hash format prefixes recognized by the multi hasher
+const (
+	PrefixBcrypt   = "$2a$"
+	PrefixArgon2id = "$argon2id$"
+	PrefixScrypt   = "$scrypt$"
+	PrefixFast     = fastPrefix
+)
+
+// prefixer is a built-in hasher telling the prefix of the hashes it makes
+type prefixer interface {
+	hashPrefix() string
+}
+
+type multiHasher struct {
+	primary Hasher
+	hashers map[string]Hasher
+	// own - is the prefix of primary hashes, empty when it can't be told
+	own string
+}
+
+// prefix extracts the "$id$" algorithm marker of a hash
+func prefix(hash string) string {
+	if !strings.HasPrefix(hash, "$") {
+		return ""
+	}
+	end := strings.IndexByte(hash[1:], '$')
+	if end < 0 {
+		return ""
+	}
+	switch id := hash[:end+2]; id {
+	case "$2b$", "$2y$":
+		return PrefixBcrypt
+	default:
+		return id
+	}
+}
+
+func (m *multiHasher) Hash(ctx context.Context, password string) (string, error) {
+	return m.primary.Hash(ctx, password)
+}
+
+// Compare verifies with the hasher registered for the hash prefix. Hashes
+// of unregistered format are tried against every hasher, primary first, so
+// a mixed user base can sign in during a migration.
+func (m *multiHasher) Compare(ctx context.Context, hash, password string) bool {
+	if hasher, ok := m.hashers[prefix(hash)]; ok {
+		return hasher.Compare(ctx, hash, password)
+	}
+
+	if m.primary.Compare(ctx, hash, password) {
+		return true
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(m.hashers)) {
+		if hasher := m.hashers[id]; hasher != m.primary && hasher.Compare(ctx, hash, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// valid reports whether a primary hasher is present
+func (m *multiHasher) valid() bool {
+	return m.primary != nil
+}
+
+// NeedsRehash reports hashes of another format than primary's. When primary
+// is neither registered nor built-in, only hashes of the other registered
+// formats are told apart.
+func (m *multiHasher) NeedsRehash(hash string) bool {
+	id := prefix(hash)
+	if m.own != "" {
+		if id != m.own {
+			return true
+		}
+	} else if hasher, ok := m.hashers[id]; ok && hasher != m.primary {
+		return true
+	}
+	if rehasher, ok := m.primary.(Rehasher); ok {
+		return rehasher.NeedsRehash(hash)
+	}
+	return false
+}
+
+// NewMultiHasher hashes with primary and verifies with the hasher registered
+// for the stored hash prefix (see Prefix constants). Successful sign ins
+// rehash to primary. New refuses a multi hasher without primary.
+func NewMultiHasher(primary Hasher, hashers map[string]Hasher) Hasher {
+	m := &multiHasher{
+		primary: primary,
+		hashers: hashers,
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(hashers)) {
+		if hashers[id] == primary {
+			m.own = id
+			break
+		}
+	}
+	if p, ok := primary.(prefixer); ok && m.own == "" {
+		m.own = p.hashPrefix()
+	}
+
+	return m
+}
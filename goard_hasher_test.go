@@ -0,0 +1,410 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestFlagOutdatedHashes(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{Hasher: NewBcryptHasher(bcrypt.MinCost + 1)})
+
+	for id, cost := range map[int64]int{1: bcrypt.MinCost, 2: bcrypt.MinCost + 1, 3: bcrypt.MinCost} {
+		if _, err := g.app.CreateAccount(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte("Secret-pass-1"), cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.database.CreateCredentials(ctx, &Credentials{
+			id:       id,
+			login:    "user" + strconv.FormatInt(id, 10),
+			passhash: string(hash),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flagged, err := g.FlagOutdatedHashes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flagged != 2 {
+		t.Fatalf("FlagOutdatedHashes = %d, want 2", flagged)
+	}
+
+	for id, want := range map[int64]bool{1: true, 2: false, 3: true} {
+		creds, err := g.database.CredentialsByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.mustChange != want {
+			t.Errorf("account %d mustChange = %v, want %v", id, creds.mustChange, want)
+		}
+	}
+
+	session, err := g.AuthenticatePassword(ctx, "user1", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.MustChangePassword() {
+		t.Error("session of a flagged account doesn't require a password change")
+	}
+
+	// Flagged accounts are not counted twice
+	if flagged, err := g.FlagOutdatedHashes(ctx); err != nil || flagged != 0 {
+		t.Fatalf("second FlagOutdatedHashes = %d, %v, want 0", flagged, err)
+	}
+}
+
+func TestFlagOutdatedHashesVisitsEveryShard(t *testing.T) {
+	ctx := context.Background()
+	shards := map[string]Database{"acme": newTestDatabase(t), "globex": newTestDatabase(t)}
+	g := newTestGoard(t, &Config{
+		Database: NewShardedDatabase(shards, nil),
+		Hasher:   NewBcryptHasher(bcrypt.MinCost + 1),
+	})
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Secret-pass-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both shards hold an account 1, the flag must land on each
+	for tenant, db := range shards {
+		if err := db.CreateCredentials(ctx, &Credentials{id: 1, tenant: tenant, login: "alice", passhash: string(hash)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flagged, err := g.FlagOutdatedHashes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flagged != 2 {
+		t.Fatalf("FlagOutdatedHashes = %d, want 2", flagged)
+	}
+
+	for tenant, db := range shards {
+		creds, err := db.CredentialsByID(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !creds.mustChange {
+			t.Errorf("%s account not flagged", tenant)
+		}
+	}
+}
+
+func TestMultiHasherNeedsRehash(t *testing.T) {
+	ctx := context.Background()
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost)
+
+	// The primary is not registered, its own prefix tells its hashes apart
+	multi := NewMultiHasher(bcryptHasher, map[string]Hasher{PrefixFast: testHasher}).(Rehasher)
+
+	own, err := bcryptHasher.Hash(ctx, "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multi.NeedsRehash(own) {
+		t.Error("primary hash flagged for rehash")
+	}
+
+	fast, err := testHasher.Hash(ctx, "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !multi.NeedsRehash(fast) {
+		t.Error("registered secondary hash not flagged for rehash")
+	}
+
+	if !multi.NeedsRehash("$scrypt$whatever") {
+		t.Error("unknown format not flagged for rehash")
+	}
+}
+
+func TestFastTestHasherGuard(t *testing.T) {
+	ctx := context.Background()
+
+	guarded := NewFastTestHasher(false)
+	if _, err := guarded.Hash(ctx, "Secret-pass-1"); !errors.Is(err, ErrUnsafeHasher) {
+		t.Fatalf("Hash without unsafe = %v, want ErrUnsafeHasher", err)
+	}
+
+	hash, err := testHasher.Hash(ctx, "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guarded.Compare(ctx, hash, "Secret-pass-1") {
+		t.Fatal("Compare without unsafe matched")
+	}
+	if !testHasher.Compare(ctx, hash, "Secret-pass-1") || testHasher.Compare(ctx, hash, "Secret-pass-2") {
+		t.Fatal("unsafe fast hasher compares wrong")
+	}
+}
+
+func TestFastTestHasherSpeedup(t *testing.T) {
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := NewBcryptHasher(DEFAULT_COST).Hash(ctx, "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	slow := time.Since(start)
+
+	start = time.Now()
+	for range 100 {
+		if _, err := testHasher.Hash(ctx, "Secret-pass-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fast := time.Since(start); fast >= slow {
+		t.Fatalf("100 fast hashes took %v, one bcrypt hash %v", fast, slow)
+	}
+}
+
+func BenchmarkBcryptHasher(b *testing.B) {
+	hasher := NewBcryptHasher(DEFAULT_COST)
+	for range b.N {
+		if _, err := hasher.Hash(context.Background(), "Secret-pass-1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFastTestHasher(b *testing.B) {
+	for range b.N {
+		if _, err := testHasher.Hash(context.Background(), "Secret-pass-1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// spyHasher counts the comparisons it is asked for
+type spyHasher struct {
+	Hasher
+	compared int
+}
+
+func (s *spyHasher) Compare(ctx context.Context, hash, password string) bool {
+	s.compared++
+	return s.Hasher.Compare(ctx, hash, password)
+}
+
+func TestMultiHasherDispatch(t *testing.T) {
+	ctx := context.Background()
+
+	bcryptSpy := &spyHasher{Hasher: NewBcryptHasher(bcrypt.MinCost)}
+	argonSpy := &spyHasher{Hasher: NewArgon2Hasher(Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})}
+	fastSpy := &spyHasher{Hasher: testHasher}
+
+	multi := NewMultiHasher(bcryptSpy, map[string]Hasher{
+		PrefixBcrypt:   bcryptSpy,
+		PrefixArgon2id: argonSpy,
+		PrefixFast:     fastSpy,
+	})
+
+	for _, spy := range []*spyHasher{bcryptSpy, argonSpy, fastSpy} {
+		hash, err := spy.Hasher.Hash(ctx, "Secret-pass-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bcryptSpy.compared, argonSpy.compared, fastSpy.compared = 0, 0, 0
+		if !multi.Compare(ctx, hash, "Secret-pass-1") {
+			t.Fatalf("%s hash did not verify", prefix(hash))
+		}
+		if spy.compared != 1 || bcryptSpy.compared+argonSpy.compared+fastSpy.compared != 1 {
+			t.Fatalf("%s hash was not dispatched to its hasher alone", prefix(hash))
+		}
+	}
+
+	if multi.Compare(ctx, "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", "Secret-pass-1") {
+		t.Fatal("unknown format verified")
+	}
+	if multi.Compare(ctx, "plaintext", "plaintext") {
+		t.Fatal("unprefixed hash verified")
+	}
+}
+
+func TestBcryptHasherCancellation(t *testing.T) {
+	// Slow enough that waiting for bcrypt would stand out
+	hasher := NewBcryptHasher(14)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := hasher.Hash(ctx, "Secret-pass-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Hash = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("Hash returned after %v", elapsed)
+	}
+
+	// A context done up front skips the work altogether
+	start = time.Now()
+	if _, err := hasher.Hash(ctx, "Secret-pass-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Hash = %v, want context.Canceled", err)
+	}
+	if hasher.Compare(ctx, "$2a$14$abcdefghijklmnopqrstuv", "Secret-pass-1") {
+		t.Fatal("Compare matched on a cancelled context")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("cancelled calls took %v", elapsed)
+	}
+}
+
+func TestRehashOnCostBump(t *testing.T) {
+	ctx := context.Background()
+	app, db := &testApp{}, newTestDatabase(t)
+
+	before := newTestGoard(t, &Config{App: app, Database: db, Hasher: NewBcryptHasher(bcrypt.MinCost)})
+	account := signUpAccount(t, before, "alice", "Secret-pass-1")
+
+	after := newTestGoard(t, &Config{App: app, Database: db, Hasher: NewBcryptHasher(bcrypt.MinCost + 1)})
+	cost := func() int {
+		t.Helper()
+		creds, err := db.CredentialsByID(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost([]byte(creds.passhash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cost
+	}
+
+	// A wrong password never rehashes
+	if _, err := after.AuthenticatePassword(ctx, "alice", "Wrong-pass-1"); !errors.Is(err, ErrCredentialsMismatch) {
+		t.Fatalf("wrong password = %v, want ErrCredentialsMismatch", err)
+	}
+	if c := cost(); c != bcrypt.MinCost {
+		t.Fatalf("cost after a failed sign in = %d, want %d", c, bcrypt.MinCost)
+	}
+
+	if _, err := after.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if c := cost(); c != bcrypt.MinCost+1 {
+		t.Fatalf("cost after sign in = %d, want %d", c, bcrypt.MinCost+1)
+	}
+	if _, err := after.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatalf("sign in with the rehashed password: %v", err)
+	}
+}
+
+func TestMultiHasherMixedUserBase(t *testing.T) {
+	ctx := context.Background()
+	app, db := &testApp{}, newTestDatabase(t)
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost)
+	argon2Hasher := NewArgon2Hasher(Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+
+	// Accounts signed up over the years under different hashers
+	for login, hasher := range map[string]Hasher{"alice": bcryptHasher, "bob": testHasher, "carol": argon2Hasher} {
+		g := newTestGoard(t, &Config{App: app, Database: db, Hasher: hasher})
+		signUpAccount(t, g, login, "Secret-pass-1")
+	}
+
+	g := newTestGoard(t, &Config{App: app, Database: db, Hasher: NewMultiHasher(argon2Hasher, map[string]Hasher{
+		PrefixBcrypt:   bcryptHasher,
+		PrefixArgon2id: argon2Hasher,
+		PrefixFast:     testHasher,
+	})})
+
+	for _, login := range []string{"alice", "bob", "carol"} {
+		if _, err := g.AuthenticatePassword(ctx, login, "Secret-pass-1"); err != nil {
+			t.Fatalf("%s: %v", login, err)
+		}
+		creds, err := db.CredentialsByLogin(ctx, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix(creds.passhash) != PrefixArgon2id {
+			t.Errorf("%s: hash %q not moved to argon2", login, creds.passhash)
+		}
+	}
+
+	if New(&Config{App: app, Database: db, Container: NewCookiesContainer("sid"), Hasher: NewMultiHasher(nil, map[string]Hasher{PrefixBcrypt: bcryptHasher})}) != nil {
+		t.Fatal("New accepted a multi hasher without primary")
+	}
+}
+
+// racingHasher always asks for a rehash and runs during, once per arm, while
+// the password is compared, as a concurrent admin request would
+type racingHasher struct {
+	Hasher
+	during func()
+}
+
+func (h *racingHasher) Compare(ctx context.Context, hash, password string) bool {
+	if during := h.during; during != nil {
+		h.during = nil
+		during()
+	}
+	return h.Hasher.Compare(ctx, hash, password)
+}
+
+func (h *racingHasher) NeedsRehash(string) bool {
+	return true
+}
+
+func TestRehashKeepsConcurrentRoleChanges(t *testing.T) {
+	ctx := context.Background()
+	hasher := &racingHasher{Hasher: testHasher}
+	g := newTestGoard(t, &Config{Hasher: hasher})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	for _, role := range []string{"editor", "viewer"} {
+		if err := g.database.AddRole(ctx, account, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revoke := func(role string) func() {
+		return func() {
+			if err := g.database.RemoveRole(ctx, account, role); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	roles := func() []string {
+		t.Helper()
+		creds, err := g.database.CredentialsByID(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds.Roles()
+	}
+
+	// The sign in loaded editor before the revocation, the rehash must not restore it
+	hasher.during = revoke("editor")
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); !slices.Equal(got, []string{"viewer"}) {
+		t.Fatalf("roles after a rehashing sign in = %v, want [viewer]", got)
+	}
+
+	// Nor may the new password of a password change
+	session, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher.during = revoke("viewer")
+	if _, err := g.changePassword(ctx, session.ID(), "Secret-pass-1", "Secret-pass-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); len(got) != 0 {
+		t.Fatalf("roles after a password change = %v, want none", got)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-2"); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+}
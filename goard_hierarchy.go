@@ -0,0 +1,69 @@
+package goard
+
+import "slices"
+
+// roleHierarchy maps a role to every role it implies, directly or not
+type roleHierarchy map[string][]string
+
+// newRoleHierarchy expands Config.RoleHierarchy, reporting false when a role
+// ends up implying itself
+func newRoleHierarchy(direct map[string][]string) (roleHierarchy, bool) {
+	if len(direct) == 0 {
+		return nil, true
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	h := make(roleHierarchy, len(direct))
+	state := make(map[string]int, len(direct))
+
+	var visit func(role string) bool
+	visit = func(role string) bool {
+		switch state[role] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+		state[role] = visiting
+
+		var implied []string
+		for _, lower := range direct[role] {
+			if !visit(lower) {
+				return false
+			}
+			implied = append(implied, lower)
+			implied = append(implied, h[lower]...)
+		}
+		slices.Sort(implied)
+		h[role] = slices.Compact(implied)
+
+		state[role] = visited
+		return true
+	}
+
+	for role := range direct {
+		if !visit(role) {
+			return nil, false
+		}
+	}
+
+	return h, true
+}
+
+// expand adds the roles implied by roles, sorted
+func (h roleHierarchy) expand(roles []string) []string {
+	if len(h) == 0 {
+		return roles
+	}
+
+	effective := slices.Clone(roles)
+	for _, role := range roles {
+		effective = append(effective, h[role]...)
+	}
+	slices.Sort(effective)
+	return slices.Compact(effective)
+}
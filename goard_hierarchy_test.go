@@ -0,0 +1,72 @@
+package goard
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestRoleHierarchy(t *testing.T) {
+	g := newTestGoard(t, &Config{RoleHierarchy: map[string][]string{
+		"superadmin": {"admin"},
+		"admin":      {"editor"},
+		"editor":     {"viewer"},
+	}})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	if err := g.database.AddRole(context.Background(), account, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	session, err := g.Authorize(context.Background(), cookieSession(g, cookie))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(session.Roles(), []string{"admin"}) {
+		t.Fatalf("roles = %v, want the granted [admin]", session.Roles())
+	}
+	if want := []string{"admin", "editor", "viewer"}; !slices.Equal(session.EffectiveRoles(), want) {
+		t.Fatalf("effective roles = %v, want %v", session.EffectiveRoles(), want)
+	}
+
+	for _, tc := range []struct {
+		filter func(*Session) bool
+		want   int
+	}{
+		{RequireRole("viewer"), http.StatusOK},
+		{RequireAllRoles("admin", "viewer"), http.StatusOK},
+		{RequireAnyRole("superadmin", "editor"), http.StatusOK},
+		{RequireRole("superadmin"), http.StatusForbidden},
+	} {
+		if rec := serve(g.Guard(okHandler, tc.filter), http.MethodGet, cookie); rec.Code != tc.want {
+			t.Errorf("Guard = %d, want %d", rec.Code, tc.want)
+		}
+	}
+}
+
+func TestRoleHierarchyCycles(t *testing.T) {
+	for _, hierarchy := range []map[string][]string{
+		{"admin": {"admin"}},
+		{"admin": {"editor"}, "editor": {"admin"}},
+		{"admin": {"editor"}, "editor": {"viewer"}, "viewer": {"admin"}},
+	} {
+		if g := New(&Config{
+			App:           &testApp{},
+			Database:      newTestDatabase(t),
+			Container:     NewCookiesContainer("sid"),
+			Hasher:        testHasher,
+			Admin:         Admin{Account: BaseAccount{}, Login: "root", Password: "Root-pass-1"},
+			RoleHierarchy: hierarchy,
+		}); g != nil {
+			t.Errorf("New accepted the cyclic hierarchy %v", hierarchy)
+		}
+	}
+
+	// Diamonds share roles without a cycle
+	newTestGoard(t, &Config{RoleHierarchy: map[string][]string{
+		"admin":     {"editor", "moderator"},
+		"editor":    {"viewer"},
+		"moderator": {"viewer"},
+	}})
+}
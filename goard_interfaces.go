@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
 type App interface {
@@ -12,6 +13,12 @@ type App interface {
 	DeleteAccount(ctx context.Context, id int64) error
 }
 
+// RoleManager is an App delegating role administration, e.g. to tenant admins.
+// It replaces the admin-only check of SetRole and UnsetRole.
+type RoleManager interface {
+	CanManageRoles(ctx context.Context, actor *Session, account int64) (bool, error)
+}
+
 type Account interface {
 	GetID() int64
 }
@@ -25,6 +32,37 @@ type Store interface {
 	Count(context.Context) int
 }
 
+// UpdatingStore is a Store replacing a session only while it exists, so an
+// update racing a revocation can't bring the session back
+type UpdatingStore interface {
+	// UpdateSession returns ErrSessionNotFound when the session is gone
+	UpdateSession(context.Context, *Session) error
+}
+
+// RefreshStore keeps refresh tokens by hash
+type RefreshStore interface {
+	CreateRefresh(context.Context, *RefreshToken) error
+	// ConsumeRefresh marks the token used and returns it as it was before
+	ConsumeRefresh(ctx context.Context, hash string) (*RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+	// RevokeSession deletes the family of the token issued along the session, e.g. on sign out
+	RevokeSession(ctx context.Context, session string) error
+	// RevokeAccount deletes every token of an account on a tenant, e.g. after a password change
+	RevokeAccount(ctx context.Context, tenant string, account int64) error
+	// ResetRefresh deletes every token, see RevokeAll
+	ResetRefresh(ctx context.Context) error
+	DeleteExpiredRefresh(ctx context.Context, t time.Time) error
+}
+
+// EpochStore keeps the generation stateless session tokens are signed under.
+// RevokeAll bumps it and the JWT container refuses tokens of an older one, so
+// share and persist it (e.g. a Redis key or a database row) to reach every
+// instance and survive restarts.
+type EpochStore interface {
+	CurrentEpoch(context.Context) (int64, error)
+	BumpEpoch(context.Context) (int64, error)
+}
+
 type Database interface {
 	Migrate(context.Context) error
 	CredentialsByLogin(context.Context, string) (*Credentials, error)
@@ -32,6 +70,36 @@ type Database interface {
 	CredentialsByID(context.Context, int64) (*Credentials, error)
 	DeleteCredentials(context.Context, int64) error
 	UpdateCredentials(context.Context, *Credentials) error
+	// UpdatePasshash replaces the password hash only, leaving the roles as they are stored
+	UpdatePasshash(ctx context.Context, id int64, passhash string) error
+	ListRoles(context.Context) ([]string, error)
+	AddRole(ctx context.Context, id int64, role string) error
+	// AddRoleUntil grants a role that lapses at until
+	AddRoleUntil(ctx context.Context, id int64, role string, until time.Time) error
+	RemoveRole(ctx context.Context, id int64, role string) error
+	CountRole(ctx context.Context, role string) (int, error)
+	DeleteExpiredPermissions(context.Context) (int64, error)
+	RenameRole(ctx context.Context, from, to string) error
+	// DeleteRole revokes the role from every holder and forgets it
+	DeleteRole(ctx context.Context, role string) error
+	ForEachCredentials(context.Context, func(*Credentials) error) error
+	SetMustChangePassword(ctx context.Context, id int64, must bool) error
+}
+
+// PermissionDatabase is a Database keeping fine grained permissions, e.g.
+// posts:write, apart from roles. Credentials carry them as Permissions.
+type PermissionDatabase interface {
+	AddPermission(ctx context.Context, id int64, permission string) error
+	RemovePermission(ctx context.Context, id int64, permission string) error
+}
+
+// RoleProvider keeps the roles of accounts, e.g. in an external authorization
+// service. The Database is the default provider.
+type RoleProvider interface {
+	RolesByID(ctx context.Context, id int64) ([]string, error)
+	AddRole(ctx context.Context, id int64, role string) error
+	RemoveRole(ctx context.Context, id int64, role string) error
+	ListRoles(ctx context.Context) ([]string, error)
 }
 
 type Transport interface {
@@ -41,16 +109,100 @@ type Transport interface {
 	UnsetRole(*http.Request) (account int64, role string, err error)
 }
 
+// SignInWriter is a Transport writing the response of a successful sign in
+// carrying the session. Without it SignIn answers 200 with no body.
+type SignInWriter interface {
+	WriteSignIn(http.ResponseWriter, *Session) error
+}
+
+// OffboardTransport is a Transport reading offboarding requests, see Offboard
+type OffboardTransport interface {
+	Offboard(*http.Request) (account int64, err error)
+}
+
+// VerifyTransport is a Transport reading password confirmations, see VerifyPassword
+type VerifyTransport interface {
+	VerifyPassword(*http.Request) (password string, err error)
+}
+
+// CheckTransport is a Transport reading permission checks, see CheckPermissions
+type CheckTransport interface {
+	CheckPermissions(*http.Request) (permissions []string, err error)
+}
+
+// ScopedTransport is a Transport reading the scopes a sign in asks its session
+// to be limited to, see Config.Scopes
+type ScopedTransport interface {
+	SignInScoped(*http.Request) (login, password string, scopes []string, err error)
+}
+
+// PermissionTransport is a Transport reading permission grants, see SetPermission
+type PermissionTransport interface {
+	SetPermission(*http.Request) (account int64, permission string, err error)
+	UnsetPermission(*http.Request) (account int64, permission string, err error)
+}
+
+// PasswordTransport is a Transport reading password changes, see ChangePassword
+type PasswordTransport interface {
+	ChangePassword(*http.Request) (current, password string, err error)
+}
+
+// UnlockTransport is a Transport reading unlock requests, see RequestUnlock
+type UnlockTransport interface {
+	RequestUnlock(*http.Request) (login string, err error)
+	Unlock(*http.Request) (token string, err error)
+}
+
 type Container interface {
 	GetSession(*http.Request) string
 	SetSession(http.ResponseWriter, *Session)
 }
 
+// SessionClearer is a Container making the client forget the session on sign out
+type SessionClearer interface {
+	ClearSession(http.ResponseWriter, *http.Request)
+}
+
+// ClaimsDecoder is implemented by containers carrying verified session claims
+// (e.g. signed tokens), letting Guard authorize without a store lookup
+type ClaimsDecoder interface {
+	DecodeClaims(*http.Request) (*Claims, error)
+}
+
 type Validator interface {
 	Validate(ctx context.Context, login, password string) bool
 }
 
+// RuleValidator is a Validator able to tell which rules credentials fail
+type RuleValidator interface {
+	Validator
+	Failures(ctx context.Context, login, password string) []ValidationRule
+}
+
 type Hasher interface {
 	Hash(ctx context.Context, password string) (hash string, err error)
 	Compare(ctx context.Context, hash, password string) bool
 }
+
+// Rehasher is a Hasher able to tell hashes made with outdated parameters
+type Rehasher interface {
+	NeedsRehash(hash string) bool
+}
+
+type Locker interface {
+	// TryLock acquires the cleaner lease, reporting false if another instance holds it
+	TryLock(ctx context.Context) (bool, error)
+	Unlock(ctx context.Context) error
+}
+
+// OrphanReaper receives app accounts left behind when the sign up rollback fails
+type OrphanReaper interface {
+	Reap(ctx context.Context, account int64, err error)
+}
+
+// OrphanQueue retries deleting app accounts whose sign up rollback failed
+type OrphanQueue interface {
+	Enqueue(ctx context.Context, account int64) error
+	// Run retries queued deletions until ctx is done
+	Run(ctx context.Context, retry func(ctx context.Context, account int64) error)
+}
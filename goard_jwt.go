@@ -0,0 +1,307 @@
+package goard
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// JWT signing algorithms supported by the JWT container
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+type JWTConfig struct {
+	// Name - is the session cookie name
+	Name string
+	// Algorithm - is HS256 or RS256
+	Algorithm string
+	// Secret - is the HS256 signing key
+	Secret []byte
+	// PrivateKey - is the RS256 signing key, without it the container only verifies tokens and can't sign sessions in
+	PrivateKey *rsa.PrivateKey
+	// PublicKey - is the RS256 verification key, derived from PrivateKey when nil
+	PublicKey *rsa.PublicKey
+	// Issuer - is the iss claim written and required, empty skips the check
+	Issuer string
+	// Cookie - are the session cookie attributes
+	Cookie CookieOptions
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	SessionID string   `json:"sid"`
+	Account   int64    `json:"acc"`
+	Roles     []string `json:"roles,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	Issuer    string   `json:"iss,omitempty"`
+	Admin     bool     `json:"admin,omitempty"`
+	Shard     string   `json:"shard,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Perms     []string `json:"perms,omitempty"`
+	Must      bool     `json:"mcp,omitempty"`
+	Epoch     int64    `json:"epc,omitempty"`
+}
+
+type jwtContainer struct {
+	cookiesContainer
+	config JWTConfig
+	epochs EpochStore
+}
+
+// epochContainer is implemented by containers signing the token epoch in, New hands them Config.EpochStore
+type epochContainer interface {
+	useEpochs(EpochStore)
+}
+
+func (j *jwtContainer) useEpochs(epochs EpochStore) {
+	j.epochs = epochs
+}
+
+type memoryEpochs struct {
+	epoch atomic.Int64
+}
+
+// NewEpochStore keeps the token epoch in memory, it restarts from zero with the process
+func NewEpochStore() EpochStore {
+	return &memoryEpochs{}
+}
+
+func (m *memoryEpochs) CurrentEpoch(context.Context) (int64, error) {
+	return m.epoch.Load(), nil
+}
+
+func (m *memoryEpochs) BumpEpoch(context.Context) (int64, error) {
+	return m.epoch.Add(1), nil
+}
+
+func (j *jwtContainer) sign(input string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(input))
+
+	if j.config.Algorithm == RS256 {
+		if j.config.PrivateKey == nil {
+			return nil, ErrBadToken
+		}
+		return rsa.SignPKCS1v15(rand.Reader, j.config.PrivateKey, crypto.SHA256, sum[:])
+	}
+
+	mac := hmac.New(sha256.New, j.config.Secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil), nil
+}
+
+func (j *jwtContainer) verify(input string, signature []byte) bool {
+	if j.config.Algorithm == RS256 {
+		sum := sha256.Sum256([]byte(input))
+		return rsa.VerifyPKCS1v15(j.config.PublicKey, crypto.SHA256, sum[:], signature) == nil
+	}
+
+	mac := hmac.New(sha256.New, j.config.Secret)
+	mac.Write([]byte(input))
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+func (j *jwtContainer) encode(ctx context.Context, s *Session) (string, error) {
+	header, err := json.Marshal(&jwtHeader{Alg: j.config.Algorithm, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims := &jwtClaims{
+		SessionID: s.id,
+		Roles:     s.Roles(),
+		ExpiresAt: s.exp.Unix(),
+		IssuedAt:  s.iss.Unix(),
+		Issuer:    j.config.Issuer,
+		Admin:     s.admin,
+		Shard:     s.shard,
+		Scopes:    s.scopes,
+		Perms:     s.Permissions(),
+		Must:      s.MustChangePassword(),
+	}
+	if s.credentials != nil {
+		claims.Account = s.credentials.id
+	}
+	if j.epochs != nil {
+		if claims.Epoch, err = j.epochs.CurrentEpoch(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := j.sign(input)
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (j *jwtContainer) decode(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrBadToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrBadToken
+	}
+
+	// The algorithm is pinned by the config, never chosen by the token
+	var header jwtHeader
+	if err := json.Unmarshal(raw, &header); err != nil || header.Alg != j.config.Algorithm {
+		return nil, ErrBadToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !j.verify(parts[0]+"."+parts[1], signature) {
+		return nil, ErrBadToken
+	}
+
+	if raw, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, ErrBadToken
+	}
+
+	var claims jwtClaims
+	if err := json.Unmarshal(raw, &claims); err != nil || claims.SessionID == "" {
+		return nil, ErrBadToken
+	}
+
+	if j.config.Issuer != "" && claims.Issuer != j.config.Issuer {
+		return nil, ErrBadToken
+	}
+
+	if !time.Now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, ErrSessionExpired
+	}
+
+	return &claims, nil
+}
+
+func (j *jwtContainer) SetSession(w http.ResponseWriter, s *Session) {
+	token, err := j.encode(context.Background(), s)
+	if err != nil {
+		j.log().Error("goard: signing session token failed", "session", CorrelationID(s.id), "err", err)
+		return
+	}
+
+	cookie := j.cookie()
+	cookie.Expires = s.exp
+	writeCookie(w, j.log(), cookie, token)
+}
+
+// GetSession returns the session ID of a valid token, empty for tampered or expired ones
+func (j *jwtContainer) GetSession(r *http.Request) string {
+	claims, err := j.decode(readCookie(r, j.name))
+	if err != nil {
+		return ""
+	}
+	return claims.SessionID
+}
+
+// DecodeClaims implements ClaimsDecoder.
+func (j *jwtContainer) DecodeClaims(r *http.Request) (*Claims, error) {
+	claims, err := j.decode(readCookie(r, j.name))
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens signed before the last RevokeAll
+	if j.epochs != nil {
+		epoch, err := j.epochs.CurrentEpoch(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		if claims.Epoch < epoch {
+			return nil, ErrSessionRevoked
+		}
+	}
+
+	return &Claims{
+		SessionID:   claims.SessionID,
+		Account:     claims.Account,
+		Roles:       claims.Roles,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+		IssuedAt:    time.Unix(claims.IssuedAt, 0),
+		Admin:       claims.Admin,
+		Shard:       claims.Shard,
+		Scopes:      claims.Scopes,
+		Permissions: claims.Perms,
+
+		MustChangePassword: claims.Must,
+	}, nil
+}
+
+// NewJWTContainer keeps sessions in a signed JWT cookie. It returns
+// ErrJWTConfig when the config lacks the key of its algorithm and
+// ErrCookieConfig for invalid cookie options. RS256 with a PublicKey alone
+// makes a verify-only container for services trusting tokens signed by
+// another one, its SetSession logs ErrBadToken and sets no cookie.
+//
+// Sessions are still kept in the Store, so by default the token only spares
+// clients an opaque ID and revocation works as with cookies. With
+// Config.Stateless Guard trusts the token claims instead: signed out and
+// revoked sessions are then refused through the in-process list of revoked
+// session IDs, kept until their expiry. That list is not shared between
+// instances, so keep TTL short when running several. RevokeAll reaches every
+// instance through Config.EpochStore, signed into each token, as long as the
+// store is shared.
+func NewJWTContainer(config JWTConfig) (Container, error) {
+	if config.Cookie.SameSite == 0 {
+		config.Cookie.SameSite = http.SameSiteLaxMode
+	}
+
+	if config.Cookie.Path == "" {
+		config.Cookie.Path = "/"
+	}
+
+	if err := config.Cookie.validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Algorithm {
+	case HS256:
+		if len(config.Secret) == 0 {
+			return nil, ErrJWTConfig
+		}
+	case RS256:
+		if config.PrivateKey == nil && config.PublicKey == nil {
+			return nil, ErrJWTConfig
+		}
+		if config.PublicKey == nil {
+			config.PublicKey = &config.PrivateKey.PublicKey
+		}
+	default:
+		return nil, ErrJWTConfig
+	}
+
+	return &jwtContainer{
+		cookiesContainer: cookiesContainer{
+			name:    config.Name,
+			options: config.Cookie,
+		},
+		config: config,
+	}, nil
+}
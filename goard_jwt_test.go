@@ -0,0 +1,150 @@
+package goard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewJWTContainerRequiresKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, config := range map[string]JWTConfig{
+		"hs256 without secret": {Name: "sid", Algorithm: HS256},
+		"rs256 without keys":   {Name: "sid", Algorithm: RS256},
+		"unknown algorithm":    {Name: "sid", Algorithm: "none", Secret: []byte("k")},
+	} {
+		if _, err := NewJWTContainer(config); !errors.Is(err, ErrJWTConfig) {
+			t.Errorf("%s: err = %v, want ErrJWTConfig", name, err)
+		}
+	}
+
+	if _, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: RS256, PrivateKey: key}); err != nil {
+		t.Fatalf("rs256 with private key: %v", err)
+	}
+	if _, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: RS256, PublicKey: &key.PublicKey}); err != nil {
+		t.Fatalf("rs256 with public key only: %v", err)
+	}
+}
+
+func TestJWTContainerVerifyOnly(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: RS256, PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: RS256, PublicKey: &key.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &recordLogger{}
+	newTestGoard(t, &Config{Container: verifier, Logger: logger})
+
+	session := &Session{
+		id:          "3f0c1b2e-8a4d-4c55-9a1e-0b7f2d6c9e11",
+		credentials: &Credentials{id: 7},
+		exp:         time.Now().Add(time.Hour),
+		iss:         time.Now(),
+	}
+
+	rec := httptest.NewRecorder()
+	signer.SetSession(rec, session)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	if id := verifier.GetSession(r); id != session.id {
+		t.Fatalf("GetSession = %q, want %q", id, session.id)
+	}
+
+	// Without the private key nothing is signed, the failure reaches the Goard logger
+	rec = httptest.NewRecorder()
+	verifier.SetSession(rec, session)
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("verify-only container set a cookie")
+	}
+	if errs := logger.logged("error", "signing session token failed"); len(errs) != 1 {
+		t.Fatalf("errors = %v, want one", errs)
+	}
+}
+
+func TestJWTContainerRoundTrip(t *testing.T) {
+	container, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: HS256, Secret: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := &Session{
+		id:          "3f0c1b2e-8a4d-4c55-9a1e-0b7f2d6c9e11",
+		credentials: &Credentials{id: 7, roles: []string{"editor"}},
+		exp:         time.Now().Add(time.Hour),
+		iss:         time.Now(),
+	}
+
+	rec := httptest.NewRecorder()
+	container.SetSession(rec, session)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	if id := container.GetSession(r); id != session.id {
+		t.Fatalf("GetSession = %q, want %q", id, session.id)
+	}
+
+	claims, err := container.(ClaimsDecoder).DecodeClaims(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Account != 7 || len(claims.Roles) != 1 || claims.Roles[0] != "editor" {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
+
+func TestStatelessGuardSkipsStore(t *testing.T) {
+	container, err := NewJWTContainer(JWTConfig{Name: "sid", Algorithm: HS256, Secret: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{store: NewStore()}
+	g := newTestGoard(t, &Config{Container: container, Store: store, Stateless: true})
+
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	if err := g.database.AddRole(context.Background(), account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	// The token keeps the roles it was issued with
+	if err := g.database.RemoveRole(context.Background(), account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	var roles []string
+	h := g.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := SessionFromContext(r.Context())
+		roles = session.Roles()
+	}), RequireRole("editor"))
+
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("Guard = %d, want 200", rec.Code)
+	}
+	if len(roles) != 1 || roles[0] != "editor" {
+		t.Fatalf("roles = %v, want [editor]", roles)
+	}
+	if n := store.invoked.Load(); n != 0 {
+		t.Fatalf("Guard looked the session up %d times, want 0", n)
+	}
+}
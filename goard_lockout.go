@@ -0,0 +1,159 @@
+package goard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+)
+
+// attempts counts the failed sign ins of one login
+type attempts struct {
+	count  int
+	last   time.Time
+	locked time.Time
+}
+
+// unlock is a pending unlock token of a locked login
+type unlock struct {
+	key string
+	exp time.Time
+}
+
+// lockout tracks failed sign ins per login, a nil lockout never locks
+type lockout struct {
+	mu       sync.Mutex
+	max      int
+	duration time.Duration
+	entries  map[string]*attempts
+	// unlocks - are pending unlock tokens by hash, see RequestUnlock
+	unlocks map[string]unlock
+}
+
+// lockKey is kept in memory only, so unknown logins are counted like known
+// ones without database rows. Case and spacing variants share a counter.
+func lockKey(tenant, login string) string {
+	return tenant + "\x00" + strings.ToLower(strings.TrimSpace(login))
+}
+
+// locked reports whether the login is locked out at now
+func (l *lockout) locked(key string, now time.Time) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	return ok && now.Before(entry.locked)
+}
+
+// fail records a failed sign in and returns the failures counted so far,
+// locked is true only for the failure reaching the threshold
+func (l *lockout) fail(key string, now time.Time) (count int, locked bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok || !now.Before(entry.last.Add(l.duration)) {
+		entry = &attempts{}
+		l.entries[key] = entry
+	}
+
+	entry.count++
+	entry.last = now
+
+	if entry.count == l.max {
+		entry.locked = now.Add(l.duration)
+		return entry.count, true
+	}
+	return entry.count, false
+}
+
+func (l *lockout) reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// issue creates an unlock token valid for ttl, replacing the pending one of
+// the login. It returns an empty token when the login is not locked at now.
+func (l *lockout) issue(key string, now time.Time, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.entries[key]; !ok || !now.Before(entry.locked) {
+		return "", nil
+	}
+
+	for hash, pending := range l.unlocks {
+		if pending.key == key {
+			delete(l.unlocks, hash)
+		}
+	}
+	l.unlocks[hashRefresh(token)] = unlock{key: key, exp: now.Add(ttl)}
+	return token, nil
+}
+
+// redeem consumes an unlock token, clearing the failures of its login
+func (l *lockout) redeem(token string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hash := hashRefresh(token)
+	pending, ok := l.unlocks[hash]
+	if !ok {
+		return false
+	}
+	delete(l.unlocks, hash)
+
+	if !now.Before(pending.exp) {
+		return false
+	}
+	delete(l.entries, pending.key)
+	return true
+}
+
+// prune forgets logins neither locked nor failing within the window at t,
+// and expired unlock tokens
+func (l *lockout) prune(t time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, entry := range l.entries {
+		if !t.Before(entry.locked) && !t.Before(entry.last.Add(l.duration)) {
+			delete(l.entries, key)
+		}
+	}
+	for hash, pending := range l.unlocks {
+		if !t.Before(pending.exp) {
+			delete(l.unlocks, hash)
+		}
+	}
+}
+
+func newLockout(max int, duration time.Duration) *lockout {
+	if max <= 0 {
+		return nil
+	}
+	return &lockout{
+		max:      max,
+		duration: duration,
+		entries:  make(map[string]*attempts),
+		unlocks:  make(map[string]unlock),
+	}
+}
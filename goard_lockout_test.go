@@ -0,0 +1,189 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{MaxAttempts: 3, LockoutDuration: 100 * time.Millisecond})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	fail := func(n int) {
+		t.Helper()
+		for range n {
+			if _, err := g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1"); !errors.Is(err, ErrCredentialsMismatch) {
+				t.Fatalf("wrong password = %v, want ErrCredentialsMismatch", err)
+			}
+		}
+	}
+
+	// A successful sign in resets the count
+	fail(2)
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	fail(2)
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatalf("below the threshold after a reset: %v", err)
+	}
+
+	fail(3)
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("locked login = %v, want ErrAccountLocked", err)
+	}
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, request(http.MethodPost, `{"login":"alice","password":"Secret-pass-1"}`))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("SignIn of a locked login = %d, want 429", rec.Code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatalf("after the lockout: %v", err)
+	}
+
+	// Stale entries don't pile up
+	fail(1)
+	g.lockout.prune(time.Now().Add(time.Second))
+	if n := len(g.lockout.entries); n != 0 {
+		t.Fatalf("%d lockout entries after pruning", n)
+	}
+}
+
+func TestOnAccountLockedFiresOnce(t *testing.T) {
+	ctx := context.Background()
+	var calls []int
+	g := newTestGoard(t, &Config{MaxAttempts: 3, OnAccountLocked: func(_ context.Context, login string, attempts int) {
+		if login != "alice" {
+			t.Errorf("locked login %q, want alice", login)
+		}
+		calls = append(calls, attempts)
+	}})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	for range 2 {
+		g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("hook fired below the threshold: %v", calls)
+	}
+
+	// Crossing the threshold, then blocked attempts
+	for range 4 {
+		g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1")
+	}
+	if len(calls) != 1 || calls[0] != 3 {
+		t.Fatalf("hook calls = %v, want one with 3 attempts", calls)
+	}
+}
+
+func TestLockoutUnknownLogin(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{MaxAttempts: 3})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	signIn := func(login string) int {
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, request(http.MethodPost, `{"login":"`+login+`","password":"Wrong-pass-1"}`))
+		return rec.Code
+	}
+
+	// Unknown and known logins are refused alike
+	if unknown, known := signIn("ghost"), signIn("alice"); unknown != known {
+		t.Fatalf("SignIn = %d for an unknown login, %d for a wrong password", unknown, known)
+	}
+
+	// Attempts count against the normalized login
+	for _, login := range []string{"Ghost", " GHOST "} {
+		if _, err := g.AuthenticatePassword(ctx, login, "Wrong-pass-1"); !errors.Is(err, ErrCredentialsNotFound) {
+			t.Fatalf("unknown login %q = %v, want ErrCredentialsNotFound", login, err)
+		}
+	}
+	if _, err := g.AuthenticatePassword(ctx, "ghost", "Wrong-pass-1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("unknown login past MaxAttempts = %v, want ErrAccountLocked", err)
+	}
+	if code := signIn("ghost"); code != http.StatusTooManyRequests {
+		t.Fatalf("SignIn of a locked unknown login = %d, want 429", code)
+	}
+
+	if _, err := g.database.CredentialsByLogin(ctx, "ghost"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("CredentialsByLogin = %v, lockout created credentials", err)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	ctx := context.Background()
+	tokens := make(map[string]string)
+	g := newTestGoard(t, &Config{
+		MaxAttempts: 2,
+		UnlockTTL:   50 * time.Millisecond,
+		OnUnlockRequested: func(_ context.Context, login, token string) {
+			tokens[login] = token
+		},
+	})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	lock := func() {
+		t.Helper()
+		for range 2 {
+			g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1")
+		}
+		if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); !errors.Is(err, ErrAccountLocked) {
+			t.Fatalf("sign in = %v, want ErrAccountLocked", err)
+		}
+	}
+	call := func(handler http.HandlerFunc, body string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, request(http.MethodPost, body))
+		return rec.Code
+	}
+
+	lock()
+
+	// Logins that aren't locked are answered alike, without a token
+	for _, login := range []string{"alice", "bob"} {
+		if code := call(g.RequestUnlock, `{"login":"`+login+`"}`); code != http.StatusAccepted {
+			t.Fatalf("RequestUnlock %s = %d, want 202", login, code)
+		}
+	}
+	if _, ok := tokens["bob"]; ok || tokens["alice"] == "" {
+		t.Fatalf("tokens = %v, want alice's only", tokens)
+	}
+
+	if code := call(g.Unlock, `{"token":"not-the-token"}`); code != http.StatusForbidden {
+		t.Fatalf("Unlock with a wrong token = %d, want 403", code)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("after a wrong token = %v, want ErrAccountLocked", err)
+	}
+
+	token := tokens["alice"]
+	if code := call(g.Unlock, `{"token":"`+token+`"}`); code != http.StatusOK {
+		t.Fatalf("Unlock = %d, want 200", code)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatalf("after unlocking: %v", err)
+	}
+	if code := call(g.Unlock, `{"token":"`+token+`"}`); code != http.StatusForbidden {
+		t.Fatalf("reused token = %d, want 403", code)
+	}
+
+	// Expired tokens unlock nothing
+	lock()
+	if code := call(g.RequestUnlock, `{"login":"alice"}`); code != http.StatusAccepted {
+		t.Fatalf("RequestUnlock = %d, want 202", code)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if code := call(g.Unlock, `{"token":"`+tokens["alice"]+`"}`); code != http.StatusForbidden {
+		t.Fatalf("expired token = %d, want 403", code)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("after an expired token = %v, want ErrAccountLocked", err)
+	}
+}
@@ -0,0 +1,29 @@
+package goard
+
+import "log/slog"
+
+// Logger receives structured logs as alternating key/value pairs, *slog.Logger
+// implements it. Goard never passes passwords, hashes or raw session IDs.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// sessionAttrs identifies a session in logs by its CorrelationID and account
+func sessionAttrs(s *Session) []any {
+	attrs := []any{"session", CorrelationID(s.id)}
+	if s.account != nil {
+		attrs = append(attrs, "account", s.account.GetID())
+	}
+	return attrs
+}
+
+// defaultLogger is slog.Default, looked up on use so slog.SetDefault applies
+type defaultLogger struct{}
+
+func (defaultLogger) Debug(msg string, args ...any) { slog.Debug(msg, args...) }
+func (defaultLogger) Info(msg string, args ...any)  { slog.Info(msg, args...) }
+func (defaultLogger) Warn(msg string, args ...any)  { slog.Warn(msg, args...) }
+func (defaultLogger) Error(msg string, args ...any) { slog.Error(msg, args...) }
@@ -0,0 +1,80 @@
+package goard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoggerOrphanedAccount(t *testing.T) {
+	logger := &recordLogger{}
+	g := newTestGoard(t, &Config{
+		Logger:      logger,
+		App:         &flakyApp{testApp: &testApp{}, failures: 1, deleted: make(chan int64, 1)},
+		Database:    &brokenDatabase{Database: newTestDatabase(t)},
+		OrphanQueue: fullQueue{},
+	})
+
+	if _, err := g.signup(context.Background(), json.RawMessage(`{}`), "alice", "Secret-pass-1"); err == nil {
+		t.Fatal("signup succeeded without credentials")
+	}
+
+	records := logger.logged("error", "orphaned account")
+	if len(records) != 1 {
+		t.Fatalf("orphan records = %v, want one", records)
+	}
+	if args := records[0].args; !slices.Equal(args[:2], []any{"account", int64(1)}) {
+		t.Fatalf("orphan args = %v, want the account ID first", args)
+	}
+
+	hash, err := testHasher.Hash(context.Background(), "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range logger.records {
+		line := fmt.Sprint(r.msg, r.args)
+		if strings.Contains(line, "Secret-pass-1") || strings.Contains(line, hash) {
+			t.Fatalf("secret logged: %s", line)
+		}
+	}
+}
+
+func TestSessionAttrs(t *testing.T) {
+	session := &Session{id: "9b2f6a1c-3d4e-4f50-8a6b-7c8d9e0f1a2b", account: BaseAccount{ID: 7}}
+
+	attrs := sessionAttrs(session)
+	if want := []any{"session", CorrelationID(session.id), "account", int64(7)}; !slices.Equal(attrs, want) {
+		t.Fatalf("attrs = %v, want %v", attrs, want)
+	}
+	if strings.Contains(fmt.Sprint(attrs...), session.id) {
+		t.Fatal("raw session ID logged")
+	}
+}
+
+func TestDefaultLogger(t *testing.T) {
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&out, nil)))
+	defer slog.SetDefault(previous)
+
+	NewLogReaper().Reap(context.Background(), 7, errors.New("app unavailable"))
+
+	var record struct {
+		Level   string `json:"level"`
+		Msg     string `json:"msg"`
+		Account int64  `json:"account"`
+		Err     string `json:"err"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("slog output %q: %v", out.String(), err)
+	}
+	if record.Level != "ERROR" || record.Account != 7 || record.Err != "app unavailable" {
+		t.Fatalf("record = %+v, want an ERROR for account 7", record)
+	}
+}
@@ -0,0 +1,150 @@
+package goard
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives auth events as they happen, e.g. to feed Prometheus
+// collectors such as signin_success_total, signin_failure_total{reason},
+// signup_total, session_active and a hasher latency histogram
+type Metrics interface {
+	SignInSucceeded()
+	// SignInFailed - reason is one of bad_credentials, unknown_login,
+	// wrong_password, locked or error
+	SignInFailed(reason string)
+	SignedUp()
+	// ActiveSessions - reports the store session count after each cleanup sweep
+	ActiveSessions(n int)
+	// HasherObserved - reports how long a Hash or Compare call took, op is "hash" or "compare"
+	HasherObserved(op string, d time.Duration)
+}
+
+// metrics counts sign in, sign up and cleanup outcomes for MetricsHandler and
+// forwards them to Config.Metrics
+type metrics struct {
+	hook Metrics
+
+	signins        atomic.Int64
+	signinFailures atomic.Int64
+	signinLocked   atomic.Int64
+	signups        atomic.Int64
+	signupFailures atomic.Int64
+	sweeps         atomic.Int64
+	sweepFailures  atomic.Int64
+	expired        atomic.Int64
+	permissions    atomic.Int64
+}
+
+func (m *metrics) signin(err error) {
+	if err == nil {
+		m.signins.Add(1)
+	} else if errors.Is(err, ErrAccountLocked) {
+		m.signinLocked.Add(1)
+	} else {
+		m.signinFailures.Add(1)
+	}
+
+	if m.hook == nil {
+		return
+	}
+	if err == nil {
+		m.hook.SignInSucceeded()
+	} else {
+		m.hook.SignInFailed(failureReason(err))
+	}
+}
+
+// failureReason is the Metrics.SignInFailed reason of a sign in error
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrAccountLocked):
+		return "locked"
+	case errors.Is(err, ErrBadCredentials):
+		return "bad_credentials"
+	case errors.Is(err, ErrCredentialsNotFound):
+		return "unknown_login"
+	case errors.Is(err, ErrCredentialsMismatch):
+		return "wrong_password"
+	default:
+		return "error"
+	}
+}
+
+func (m *metrics) signup(err error) {
+	if err == nil {
+		m.signups.Add(1)
+		if m.hook != nil {
+			m.hook.SignedUp()
+		}
+	} else {
+		m.signupFailures.Add(1)
+	}
+}
+
+func (m *metrics) hasher(op string, start time.Time) {
+	if m.hook != nil {
+		m.hook.HasherObserved(op, time.Since(start))
+	}
+}
+
+func (m *metrics) sweep(err error) {
+	if err == nil {
+		m.sweeps.Add(1)
+	} else {
+		m.sweepFailures.Add(1)
+	}
+}
+
+// MetricsHandler exposes session, sign in, sign up and cleanup counters in the
+// Prometheus text format, mount it on a route such as /metrics
+func (g *Goard) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		m := &g.metrics
+		writeMetric(w, "goard_active_sessions", "gauge", "Sessions held by the store.",
+			sample{value: int64(g.store.Count(r.Context()))},
+		)
+		writeMetric(w, "goard_signins_total", "counter", "Sign in attempts by outcome.",
+			sample{`outcome="success"`, m.signins.Load()},
+			sample{`outcome="failure"`, m.signinFailures.Load()},
+			sample{`outcome="locked"`, m.signinLocked.Load()},
+		)
+		writeMetric(w, "goard_signups_total", "counter", "Sign up attempts by outcome.",
+			sample{`outcome="success"`, m.signups.Load()},
+			sample{`outcome="failure"`, m.signupFailures.Load()},
+		)
+		writeMetric(w, "goard_cleanup_sweeps_total", "counter", "Cleanup sweeps by outcome.",
+			sample{`outcome="success"`, m.sweeps.Load()},
+			sample{`outcome="failure"`, m.sweepFailures.Load()},
+		)
+		writeMetric(w, "goard_cleanup_expired_sessions_total", "counter", "Expired sessions removed by cleanup sweeps.",
+			sample{value: m.expired.Load()},
+		)
+		writeMetric(w, "goard_cleanup_expired_permissions_total", "counter", "Expired role grants removed by cleanup sweeps.",
+			sample{value: m.permissions.Load()},
+		)
+	})
+}
+
+// sample is one metric value, labels are preformatted
+type sample struct {
+	labels string
+	value  int64
+}
+
+func writeMetric(w io.Writer, name, kind, help string, samples ...sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, s := range samples {
+		if s.labels == "" {
+			fmt.Fprintf(w, "%s %d\n", name, s.value)
+		} else {
+			fmt.Fprintf(w, "%s{%s} %d\n", name, s.labels, s.value)
+		}
+	}
+}
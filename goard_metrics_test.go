@@ -0,0 +1,132 @@
+package goard
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	signInCookie(t, g, "alice", "Secret-pass-1")
+
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, request(http.MethodPost, `{"login":"alice","password":"Wrong-pass-1"}`))
+	if rec.Code == http.StatusOK {
+		t.Fatal("SignIn succeeded with a wrong password")
+	}
+
+	rec = serve(g.MetricsHandler(), http.MethodGet, nil)
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q, want the Prometheus text format", got)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE goard_active_sessions gauge",
+		"goard_active_sessions 1",
+		"# TYPE goard_signins_total counter",
+		`goard_signins_total{outcome="success"} 1`,
+		`goard_signins_total{outcome="failure"} 1`,
+		`goard_signins_total{outcome="locked"} 0`,
+		`goard_signups_total{outcome="success"} 1`,
+		`goard_cleanup_sweeps_total{outcome="success"} 0`,
+		"goard_cleanup_expired_sessions_total 0",
+		"goard_cleanup_expired_permissions_total 0",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("scrape lacks %q:\n%s", line, body)
+		}
+	}
+}
+
+// fakeMetrics records the events it is given
+type fakeMetrics struct {
+	mu       sync.Mutex
+	signins  int
+	failures map[string]int
+	signups  int
+	hasher   map[string]int
+	active   chan int
+}
+
+func (m *fakeMetrics) SignInSucceeded() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signins++
+}
+
+func (m *fakeMetrics) SignInFailed(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[reason]++
+}
+
+func (m *fakeMetrics) SignedUp() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signups++
+}
+
+func (m *fakeMetrics) ActiveSessions(n int) {
+	select {
+	case m.active <- n:
+	default:
+	}
+}
+
+func (m *fakeMetrics) HasherObserved(op string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d >= 0 {
+		m.hasher[op]++
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	sink := &fakeMetrics{failures: map[string]int{}, hasher: map[string]int{}, active: make(chan int, 1)}
+	g := newTestGoard(t, &Config{Metrics: sink, MaxAttempts: 2, CI: 20 * time.Millisecond})
+
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	if _, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1"); err != nil {
+		t.Fatal(err)
+	}
+	g.AuthenticatePassword(ctx, "bob", "Secret-pass-1")
+	g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1")
+	g.AuthenticatePassword(ctx, "alice", "Wrong-pass-1")
+	g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	g.AuthenticatePassword(ctx, "", "Secret-pass-1")
+
+	sink.mu.Lock()
+	if sink.signups != 1 || sink.signins != 1 {
+		t.Errorf("signups %d, signins %d, want 1 and 1", sink.signups, sink.signins)
+	}
+	want := map[string]int{"unknown_login": 1, "wrong_password": 2, "locked": 1, "bad_credentials": 1}
+	if !maps.Equal(sink.failures, want) {
+		t.Errorf("failures = %v, want %v", sink.failures, want)
+	}
+	if sink.hasher["hash"] == 0 || sink.hasher["compare"] == 0 {
+		t.Errorf("hasher observations = %v, want hash and compare", sink.hasher)
+	}
+	sink.mu.Unlock()
+
+	if err := g.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	select {
+	case n := <-sink.active:
+		if n != 1 {
+			t.Fatalf("active sessions = %d, want 1", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no active sessions reported after a sweep")
+	}
+}
@@ -0,0 +1,289 @@
+package goard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMockMySQL returns a MySQL database over sqlmock, expectations are
+// checked when the test ends
+func newMockMySQL(t *testing.T) (Database, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewMySQLDatabase(db), mock
+}
+
+// stmt matches a statement by a distinctive fragment of it
+func stmt(fragment string) string {
+	return regexp.QuoteMeta(fragment)
+}
+
+func TestMySQLMigrate(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	for _, table := range []string{"goard_roles", "goard_creds", "goard_permissions", "goard_creds_permissions"} {
+		mock.ExpectExec(stmt("CREATE TABLE IF NOT EXISTS \n\t\t" + table + " (")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLCreateCredentials(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(stmt("INSERT INTO \n\t\tgoard_creds")).
+		WithArgs(int64(7), "acme", "alice", "hash", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(stmt("SELECT role_id FROM goard_roles WHERE role_name = ?;")).
+		WithArgs("editor").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(stmt("INSERT INTO goard_roles (role_name) VALUES (?);")).
+		WithArgs("editor").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectQuery(stmt("SELECT 1 FROM goard_permissions WHERE creds_id = ? AND role_id = ?;")).
+		WithArgs(int64(7), int32(3)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(stmt("INSERT INTO goard_permissions (creds_id, role_id, created_at) VALUES (?, ?, ?);")).
+		WithArgs(int64(7), int32(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := db.CreateCredentials(context.Background(), &Credentials{
+		id:       7,
+		tenant:   "acme",
+		login:    "alice",
+		passhash: "hash",
+		roles:    []string{"editor"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLCredentialsByLogin(t *testing.T) {
+	db, mock := newMockMySQL(t)
+	ctx := WithTenant(context.Background(), "acme")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(stmt("creds_tenant = ?\n\tAND\n\t\tcreds_login = ?;")).
+		WithArgs("acme", "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"creds_id", "creds_tenant", "creds_login", "creds_passhash", "creds_must_change"}).
+			AddRow(int64(7), "acme", "alice", "hash", true))
+	mock.ExpectQuery(stmt("goard_permissions.creds_id = ?")).
+		WithArgs(int64(7), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"role_name", "expires_at"}).
+			AddRow("editor", nil).
+			AddRow("viewer", nil))
+	mock.ExpectQuery(stmt("SELECT permission FROM goard_creds_permissions WHERE creds_id = ? ORDER BY permission;")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("posts:write"))
+	mock.ExpectCommit()
+
+	creds, err := db.CredentialsByLogin(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.id != 7 || creds.tenant != "acme" || !creds.mustChange {
+		t.Fatalf("credentials = %d %q %v, want 7 acme true", creds.id, creds.tenant, creds.mustChange)
+	}
+	if !slices.Equal(creds.roles, []string{"editor", "viewer"}) {
+		t.Fatalf("roles = %v, want [editor viewer]", creds.roles)
+	}
+	if !slices.Equal(creds.permissions, []string{"posts:write"}) {
+		t.Fatalf("permissions = %v, want [posts:write]", creds.permissions)
+	}
+}
+
+func TestMySQLCredentialsByIDNotFound(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(stmt("creds_id = ?;")).
+		WithArgs(int64(7)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := db.CredentialsByID(context.Background(), 7); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("CredentialsByID = %v, want ErrCredentialsNotFound", err)
+	}
+}
+
+func TestMySQLUpdateCredentials(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(stmt("creds_login = ?,\n\t\tcreds_passhash = ?,\n\t\tupdated_at = ?\n\tWHERE\n\t\tcreds_id = ?")).
+		WithArgs("alice", "new-hash", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(stmt("goard_permissions.creds_id = ?")).
+		WithArgs(int64(7), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"role_name", "expires_at"}).AddRow("viewer", nil))
+	mock.ExpectExec(stmt("role_id IN (SELECT role_id FROM goard_roles WHERE role_name = ?);")).
+		WithArgs(int64(7), "viewer").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(stmt("SELECT role_id FROM goard_roles WHERE role_name = ?;")).
+		WithArgs("editor").
+		WillReturnRows(sqlmock.NewRows([]string{"role_id"}).AddRow(int32(2)))
+	mock.ExpectQuery(stmt("SELECT 1 FROM goard_permissions WHERE creds_id = ? AND role_id = ?;")).
+		WithArgs(int64(7), int32(2)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(stmt("INSERT INTO goard_permissions (creds_id, role_id, created_at) VALUES (?, ?, ?);")).
+		WithArgs(int64(7), int32(2), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := db.UpdateCredentials(context.Background(), &Credentials{
+		id:       7,
+		login:    "alice",
+		passhash: "new-hash",
+		roles:    []string{"editor"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLDeleteCredentials(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(stmt("DELETE FROM goard_permissions WHERE creds_id = ?;")).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(stmt("DELETE FROM goard_creds_permissions WHERE creds_id = ?;")).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(stmt("DELETE FROM goard_creds WHERE creds_id = ?;")).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := db.DeleteCredentials(context.Background(), 7); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLRenameRole(t *testing.T) {
+	t.Run("conflict", func(t *testing.T) {
+		db, mock := newMockMySQL(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(stmt("SELECT 1 FROM goard_roles WHERE role_name = ?;")).
+			WithArgs("author").
+			WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+		mock.ExpectRollback()
+
+		if err := db.RenameRole(context.Background(), "editor", "author"); !errors.Is(err, ErrRoleConflict) {
+			t.Fatalf("RenameRole = %v, want ErrRoleConflict", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		db, mock := newMockMySQL(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(stmt("SELECT 1 FROM goard_roles WHERE role_name = ?;")).
+			WithArgs("author").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec(stmt("UPDATE goard_roles SET role_name = ? WHERE role_name = ?;")).
+			WithArgs("author", "editor").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := db.RenameRole(context.Background(), "editor", "author"); !errors.Is(err, ErrRoleNotFound) {
+			t.Fatalf("RenameRole = %v, want ErrRoleNotFound", err)
+		}
+	})
+}
+
+func TestMySQLDeleteExpiredPermissions(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectExec(stmt("DELETE FROM goard_permissions WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?;")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := db.DeleteExpiredPermissions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("DeleteExpiredPermissions = %d, want 2", n)
+	}
+}
+
+func TestMySQLSetMustChangePassword(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectExec(stmt("UPDATE goard_creds SET creds_must_change = ?, updated_at = ? WHERE creds_id = ?;")).
+		WithArgs(true, sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.SetMustChangePassword(context.Background(), 7, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLDeleteExpiredPermissionsBatches(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db := NewMySQLDatabaseWithOptions(conn, DatabaseOptions{DeleteBatch: 2})
+
+	// Full batches are followed by another, a short one ends the loop
+	for _, rows := range []int64{2, 2, 1} {
+		mock.ExpectExec(stmt("DELETE FROM goard_permissions WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?;")).
+			WithArgs(sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, rows))
+	}
+
+	n, err := db.DeleteExpiredPermissions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("DeleteExpiredPermissions = %d, want 5", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLUpdatePasshash(t *testing.T) {
+	db, mock := newMockMySQL(t)
+
+	mock.ExpectExec(stmt("UPDATE goard_creds SET creds_passhash = ?, updated_at = ? WHERE creds_id = ?;")).
+		WithArgs("new-hash", sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(stmt("UPDATE goard_creds SET creds_passhash = ?, updated_at = ? WHERE creds_id = ?;")).
+		WithArgs("new-hash", sqlmock.AnyArg(), int64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := db.UpdatePasshash(context.Background(), 7, "new-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdatePasshash(context.Background(), 8, "new-hash"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("UpdatePasshash of missing credentials = %v, want ErrCredentialsNotFound", err)
+	}
+}
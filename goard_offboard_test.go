@@ -0,0 +1,79 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// stubbornApp refuses to delete accounts
+type stubbornApp struct {
+	*testApp
+}
+
+func (a *stubbornApp) DeleteAccount(context.Context, int64) error {
+	return errors.New("app unavailable")
+}
+
+func offboard(g *Goard, admin *http.Cookie, account int64) *httptest.ResponseRecorder {
+	r := request(http.MethodDelete, `{"account":`+strconv.FormatInt(account, 10)+`}`)
+	r.AddCookie(admin)
+	rec := httptest.NewRecorder()
+	g.Offboard(rec, r)
+	return rec
+}
+
+func TestOffboard(t *testing.T) {
+	ctx := context.Background()
+	app := &testApp{}
+	g := newTestGoard(t, &Config{App: app})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	if rec := offboard(g, alice, account); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin Offboard = %d, want 403", rec.Code)
+	}
+
+	if rec := offboard(g, signInCookie(t, g, "root", "Root-pass-1"), account); rec.Code != http.StatusOK {
+		t.Fatalf("Offboard = %d, want 200", rec.Code)
+	}
+
+	if _, err := g.Authorize(ctx, cookieSession(g, alice)); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("session after Offboard = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := g.database.CredentialsByID(ctx, account); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Errorf("credentials after Offboard = %v, want ErrCredentialsNotFound", err)
+	}
+	if _, err := app.AccountByID(ctx, account); err == nil {
+		t.Error("App account survived Offboard")
+	}
+}
+
+func TestOffboardPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{App: &stubbornApp{testApp: &testApp{}}})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+
+	rec := offboard(g, signInCookie(t, g, "root", "Root-pass-1"), account)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Offboard = %d, want 500", rec.Code)
+	}
+
+	var report map[string]bool
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !report["sessions"] || !report["credentials"] || report["account"] {
+		t.Fatalf("report = %v, want sessions and credentials done, account failed", report)
+	}
+
+	// The user is signed out whatever failed
+	if _, err := g.Authorize(ctx, cookieSession(g, alice)); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("session after Offboard = %v, want ErrSessionRevoked", err)
+	}
+}
@@ -0,0 +1,114 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// post sends body to handler with the session cookie
+func post(handler http.HandlerFunc, cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+	r := request(http.MethodPost, body)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	return rec
+}
+
+func TestVerifyPassword(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+	admin := signInCookie(t, g, "root", "Root-pass-1")
+
+	for _, tc := range []struct {
+		name   string
+		cookie *http.Cookie
+		body   string
+		want   int
+	}{
+		{"correct", alice, `{"password":"Secret-pass-1"}`, http.StatusOK},
+		{"incorrect", alice, `{"password":"Secret-pass-2"}`, http.StatusForbidden},
+		{"empty", alice, `{"password":""}`, http.StatusBadRequest},
+		{"admin correct", admin, `{"password":"Root-pass-1"}`, http.StatusOK},
+		{"admin incorrect", admin, `{"password":"Secret-pass-1"}`, http.StatusForbidden},
+		{"no session", nil, `{"password":"Secret-pass-1"}`, http.StatusUnauthorized},
+	} {
+		if rec := post(g.VerifyPassword, tc.cookie, tc.body); rec.Code != tc.want {
+			t.Errorf("%s: VerifyPassword = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestNormalizePasswords(t *testing.T) {
+	ctx := context.Background()
+	// é precomposed (NFC) and as e plus a combining acute accent (NFD)
+	const nfc, nfd = "Caf\u00e9-pass-1", "Cafe\u0301-pass-1"
+
+	g := newTestGoard(t, &Config{NormalizePasswords: true})
+	signUpAccount(t, g, "alice", nfd)
+	signUpAccount(t, g, "bob", nfc)
+
+	if _, err := g.AuthenticatePassword(ctx, "alice", nfc); err != nil {
+		t.Fatalf("NFC sign in to an NFD password: %v", err)
+	}
+	if _, err := g.AuthenticatePassword(ctx, "bob", nfd); err != nil {
+		t.Fatalf("NFD sign in to an NFC password: %v", err)
+	}
+
+	// Without the flag the forms are different passwords
+	g = newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", nfd)
+	if _, err := g.AuthenticatePassword(ctx, "alice", nfc); !errors.Is(err, ErrCredentialsMismatch) {
+		t.Fatalf("AuthenticatePassword = %v, want ErrCredentialsMismatch", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	for _, rotate := range []bool{false, true} {
+		g := newTestGoard(t, &Config{RotateOnPasswordChange: rotate})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+		signUpAccount(t, g, "bob", "Secret-pass-1")
+		current := signInCookie(t, g, "alice", "Secret-pass-1")
+		other := signInCookie(t, g, "alice", "Secret-pass-1")
+		bob := signInCookie(t, g, "bob", "Secret-pass-1")
+		h := g.Guard(okHandler, func(*Session) bool { return true })
+
+		if rec := post(g.ChangePassword, current, `{"current_password":"Wrong-pass-1","password":"Secret-pass-2"}`); rec.Code != http.StatusForbidden {
+			t.Fatalf("wrong current password: %d, want 403", rec.Code)
+		}
+
+		rec := post(g.ChangePassword, current, `{"current_password":"Secret-pass-1","password":"Secret-pass-2"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ChangePassword = %d, want 200", rec.Code)
+		}
+
+		kept := current
+		if rotate {
+			kept = sessionCookie(t, rec)
+			if cookieSession(g, kept) == cookieSession(g, current) {
+				t.Fatal("session kept its ID despite RotateOnPasswordChange")
+			}
+			if rec := serve(h, http.MethodGet, current); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("rotated away session: %d, want 401", rec.Code)
+			}
+		}
+		if rec := serve(h, http.MethodGet, kept); rec.Code != http.StatusOK {
+			t.Fatalf("rotate %v: changing session: %d, want 200", rotate, rec.Code)
+		}
+		if rec := serve(h, http.MethodGet, other); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("rotate %v: other session: %d, want 401", rotate, rec.Code)
+		}
+		if rec := serve(h, http.MethodGet, bob); rec.Code != http.StatusOK {
+			t.Fatalf("rotate %v: other account: %d, want 200", rotate, rec.Code)
+		}
+
+		if _, err := g.AuthenticatePassword(context.Background(), "alice", "Secret-pass-2"); err != nil {
+			t.Fatalf("new password: %v", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	if err := g.database.AddRole(ctx, account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.database.(PermissionDatabase).AddPermission(ctx, account, "reports.export"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(login, password string) map[string]bool {
+		t.Helper()
+		rec := post(g.CheckPermissions, signInCookie(t, g, login, password),
+			`{"permissions":["editor","reports.export","billing.read"]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: CheckPermissions = %d, want 200", login, rec.Code)
+		}
+		var result map[string]bool
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	want := map[string]bool{"editor": true, "reports.export": true, "billing.read": false}
+	if got := check("alice", "Secret-pass-1"); !maps.Equal(got, want) {
+		t.Fatalf("alice = %v, want %v", got, want)
+	}
+
+	want = map[string]bool{"editor": true, "reports.export": true, "billing.read": true}
+	if got := check("root", "Root-pass-1"); !maps.Equal(got, want) {
+		t.Fatalf("admin = %v, want %v", got, want)
+	}
+
+	if rec := post(g.CheckPermissions, nil, `{"permissions":["editor"]}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: %d, want 401", rec.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+	admin := signInCookie(t, g, "root", "Root-pass-1")
+
+	change := func(handler http.HandlerFunc) {
+		t.Helper()
+		r := request(http.MethodPatch, `{"account":`+strconv.FormatInt(account, 10)+`,"permission":"posts:write"}`)
+		r.AddCookie(admin)
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("permission change = %d, want 200", rec.Code)
+		}
+	}
+
+	h := g.Guard(okHandler, RequirePermission("posts:write"))
+	if rec := serve(h, http.MethodPost, alice); rec.Code != http.StatusForbidden {
+		t.Fatalf("before the grant: %d, want 403", rec.Code)
+	}
+
+	change(g.SetPermission)
+	if rec := serve(h, http.MethodPost, alice); rec.Code != http.StatusOK {
+		t.Fatalf("after the grant: %d, want 200", rec.Code)
+	}
+	if rec := serve(h, http.MethodPost, admin); rec.Code != http.StatusOK {
+		t.Fatalf("admin: %d, want 200", rec.Code)
+	}
+
+	change(g.UnsetPermission)
+	if rec := serve(h, http.MethodPost, alice); rec.Code != http.StatusForbidden {
+		t.Fatalf("after revoking: %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package goard
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type visitor struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// rateLimiter keeps a token bucket per client IP
+type rateLimiter struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	idle     time.Duration
+	pruned   time.Time
+	visitors map[string]*visitor
+}
+
+// limiter returns the bucket of ip, forgetting buckets idle long enough to be full again
+func (l *rateLimiter) limiter(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) >= l.idle {
+		for key, v := range l.visitors {
+			if now.Sub(v.seen) >= l.idle {
+				delete(l.visitors, key)
+			}
+		}
+		l.pruned = now
+	}
+
+	v, ok := l.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[ip] = v
+	}
+	v.seen = now
+	return v.limiter
+}
+
+// clientIP is the request remote IP, or the last X-Forwarded-For hop when
+// the header is trusted, as that is the one appended by the proxy
+func clientIP(r *http.Request, forwarded bool) string {
+	if forwarded {
+		if header := r.Header.Get("X-Forwarded-For"); header != "" {
+			hops := strings.Split(header, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit throttles next with a token bucket per client IP, answering 429
+// with Retry-After once a client exceeds burst. Meant for the unauthenticated
+// SignIn and SignUp handlers, see Config.TrustForwardedFor.
+func (g *Goard) RateLimit(next http.Handler, limit rate.Limit, burst int) http.Handler {
+	idle := time.Minute
+	if limit > 0 {
+		// A bucket idle this long is full again and may be dropped
+		idle = max(idle, time.Duration(float64(burst)/float64(limit)*float64(time.Second)))
+	}
+
+	limiter := &rateLimiter{
+		limit:    limit,
+		burst:    burst,
+		idle:     idle,
+		visitors: make(map[string]*visitor),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		reservation := limiter.limiter(clientIP(r, g.trustForwarded), now).ReserveN(now, 1)
+
+		if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+			reservation.CancelAt(now)
+			if reservation.OK() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package goard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimit(t *testing.T) {
+	hit := func(h http.Handler, remote, forwarded string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/signin", nil)
+		r.RemoteAddr = remote + ":4242"
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	t.Run("remote address", func(t *testing.T) {
+		g := newTestGoard(t, &Config{})
+		h := g.RateLimit(okHandler, rate.Limit(1), 3)
+
+		for i := range 3 {
+			if rec := hit(h, "10.0.0.1", ""); rec.Code != http.StatusOK {
+				t.Fatalf("request %d within burst: %d, want 200", i+1, rec.Code)
+			}
+		}
+		rec := hit(h, "10.0.0.1", "")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("past burst: %d, want 429", rec.Code)
+		}
+		if retry := rec.Header().Get("Retry-After"); retry != "1" {
+			t.Fatalf("Retry-After = %q, want 1", retry)
+		}
+
+		// Other clients have buckets of their own, an untrusted header changes nothing
+		if rec := hit(h, "10.0.0.2", ""); rec.Code != http.StatusOK {
+			t.Fatalf("other client: %d, want 200", rec.Code)
+		}
+		if rec := hit(h, "10.0.0.1", "203.0.113.7"); rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("spoofed X-Forwarded-For: %d, want 429", rec.Code)
+		}
+	})
+
+	t.Run("forwarded", func(t *testing.T) {
+		g := newTestGoard(t, &Config{TrustForwardedFor: true})
+		h := g.RateLimit(okHandler, rate.Limit(1), 1)
+
+		if rec := hit(h, "10.0.0.1", "203.0.113.7"); rec.Code != http.StatusOK {
+			t.Fatalf("first client: %d, want 200", rec.Code)
+		}
+		if rec := hit(h, "10.0.0.1", "203.0.113.7"); rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("first client past burst: %d, want 429", rec.Code)
+		}
+		if rec := hit(h, "10.0.0.1", "198.51.100.1, 203.0.113.8"); rec.Code != http.StatusOK {
+			t.Fatalf("second client behind the proxy: %d, want 200", rec.Code)
+		}
+	})
+}
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	l := &rateLimiter{limit: rate.Limit(1), burst: 1, idle: time.Minute, visitors: make(map[string]*visitor)}
+	now := time.Now()
+
+	l.limiter("10.0.0.1", now)
+	l.limiter("10.0.0.2", now.Add(30*time.Second))
+	l.limiter("10.0.0.3", now.Add(time.Minute))
+
+	if _, ok := l.visitors["10.0.0.1"]; ok {
+		t.Fatal("idle bucket kept")
+	}
+	if len(l.visitors) != 2 {
+		t.Fatalf("%d buckets, want 2", len(l.visitors))
+	}
+}
@@ -0,0 +1,126 @@
+package goard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type logReaper struct {
+	logger Logger
+}
+
+func (l *logReaper) Reap(_ context.Context, account int64, err error) {
+	l.logger.Error("goard: orphaned account, rollback failed", "account", account, "err", err)
+}
+
+// NewLogReaper logs orphaned accounts to slog.Default, New passes Config.Logger instead
+func NewLogReaper() OrphanReaper {
+	return &logReaper{logger: defaultLogger{}}
+}
+
+const (
+	orphanBackoff     = time.Second
+	orphanMaxBackoff  = 5 * time.Minute
+	orphanMaxAttempts = 10
+)
+
+type orphan struct {
+	account  int64
+	attempts int
+	next     time.Time
+}
+
+// memoryOrphanQueue retries rollbacks with exponential backoff, giving the
+// account up to its reaper after orphanMaxAttempts failures
+type memoryOrphanQueue struct {
+	mu      sync.Mutex
+	orphans []*orphan
+	wake    chan struct{}
+	reaper  OrphanReaper
+}
+
+func (q *memoryOrphanQueue) Enqueue(_ context.Context, account int64) error {
+	q.mu.Lock()
+	q.orphans = append(q.orphans, &orphan{
+		account: account,
+		next:    time.Now().Add(orphanBackoff),
+	})
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// due removes and returns the orphans to retry at now, and when the next one is due
+func (q *memoryOrphanQueue) due(now time.Time) ([]*orphan, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ready []*orphan
+	wait := orphanMaxBackoff
+	pending := q.orphans[:0]
+
+	for _, o := range q.orphans {
+		if !now.Before(o.next) {
+			ready = append(ready, o)
+			continue
+		}
+		wait = min(wait, o.next.Sub(now))
+		pending = append(pending, o)
+	}
+
+	q.orphans = pending
+	return ready, wait
+}
+
+func (q *memoryOrphanQueue) Run(ctx context.Context, retry func(ctx context.Context, account int64) error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+
+		ready, wait := q.due(time.Now())
+
+		for _, o := range ready {
+			err := retry(ctx, o.account)
+			if err == nil {
+				continue
+			}
+
+			if o.attempts++; o.attempts >= orphanMaxAttempts {
+				q.reaper.Reap(ctx, o.account, err)
+				continue
+			}
+
+			backoff := min(orphanBackoff<<o.attempts, orphanMaxBackoff)
+			o.next = time.Now().Add(backoff)
+			wait = min(wait, backoff)
+
+			q.mu.Lock()
+			q.orphans = append(q.orphans, o)
+			q.mu.Unlock()
+		}
+
+		timer.Stop()
+		timer.Reset(wait)
+	}
+}
+
+// NewMemoryOrphanQueue keeps failed rollbacks in memory, they are lost on
+// restart. Accounts still failing after the last retry go to reaper.
+func NewMemoryOrphanQueue(reaper OrphanReaper) OrphanQueue {
+	return &memoryOrphanQueue{
+		wake:   make(chan struct{}, 1),
+		reaper: reaper,
+	}
+}
@@ -0,0 +1,263 @@
+package goard
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshTokenHeader carries refresh tokens both ways, see Config.RefreshTTL
+const RefreshTokenHeader = "X-Refresh-Token"
+
+// RefreshToken is a stored refresh token. Tokens rotated from one another
+// share a family, reusing a consumed one revokes the whole family.
+type RefreshToken struct {
+	// Hash - is the SHA-256 of the token, the token itself is never stored
+	Hash    string
+	Family  string
+	Account int64
+	Tenant  string
+	Expires time.Time
+	Used    bool
+	// Scopes - limit the sessions the token is traded for as they did the signed in one
+	Scopes []string
+	// Session - is the ID of the session issued along, revoked when the token is traded
+	Session string
+}
+
+type refreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]*RefreshToken
+}
+
+func (s *refreshStore) CreateRefresh(_ context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *token
+	s.tokens[token.Hash] = &copied
+	return nil
+}
+
+func (s *refreshStore) ConsumeRefresh(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	before := *token
+	token.Used = true
+	return &before, nil
+}
+
+func (s *refreshStore) RevokeFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.Family == family {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *refreshStore) RevokeSession(_ context.Context, session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	families := make(map[string]bool)
+	for _, token := range s.tokens {
+		if token.Session == session {
+			families[token.Family] = true
+		}
+	}
+	for hash, token := range s.tokens {
+		if families[token.Family] {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *refreshStore) RevokeAccount(_ context.Context, tenant string, account int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.Tenant == tenant && token.Account == account {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *refreshStore) ResetRefresh(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.tokens)
+	return nil
+}
+
+func (s *refreshStore) DeleteExpiredRefresh(_ context.Context, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if !t.Before(token.Expires) {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// NewRefreshStore keeps refresh tokens in memory
+func NewRefreshStore() RefreshStore {
+	return &refreshStore{
+		tokens: make(map[string]*RefreshToken),
+	}
+}
+
+func hashRefresh(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefresh creates a refresh token for the session account, family is
+// empty for a new family
+func (g *Goard) issueRefresh(ctx context.Context, session *Session, family string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if family == "" {
+		family = uuid.New().String()
+	}
+
+	if err := g.refresher.CreateRefresh(ctx, &RefreshToken{
+		Hash:    hashRefresh(token),
+		Family:  family,
+		Account: session.credentials.id,
+		Tenant:  session.shard,
+		Expires: time.Now().Add(g.refreshTTL),
+		Scopes:  session.scopes,
+		Session: session.id,
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// refresh trades a refresh token for a new session and a rotated token
+func (g *Goard) refresh(ctx context.Context, token string) (*Session, string, error) {
+	stored, err := g.refresher.ConsumeRefresh(ctx, hashRefresh(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if stored.Used {
+		// A consumed token came back, it may be stolen: end its family
+		if err := g.refresher.RevokeFamily(ctx, stored.Family); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrSessionRevoked
+	}
+
+	if !time.Now().Before(stored.Expires) {
+		return nil, "", ErrSessionExpired
+	}
+
+	if stored.Tenant != "" {
+		ctx = WithTenant(ctx, stored.Tenant)
+	}
+
+	credentials, err := g.credentialsByID(ctx, stored.Account)
+	if err != nil {
+		if errors.Is(err, ErrCredentialsNotFound) {
+			return nil, "", ErrSessionNotFound
+		}
+		return nil, "", err
+	}
+
+	account, err := g.app.AccountByID(ctx, credentials.id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The session handed out along the token is replaced, not joined
+	if stored.Session != "" {
+		if previous, err := g.store.InvokeSession(ctx, stored.Session); err == nil {
+			if err := g.revoke(ctx, previous); err != nil {
+				return nil, "", err
+			}
+		} else if !errors.Is(err, ErrSessionNotFound) {
+			return nil, "", err
+		}
+	}
+
+	if err := g.evict(ctx, credentials.id); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		id:          uuid.New().String(),
+		account:     account,
+		credentials: credentials,
+		exp:         g.expiry(now, now.Add(g.ttl), credentials.roles),
+		iss:         now,
+		shard:       stored.Tenant,
+		scopes:      stored.Scopes,
+		hierarchy:   g.hierarchy,
+	}
+
+	if err := g.store.CreateSession(ctx, session); err != nil {
+		return nil, "", err
+	}
+
+	rotated, err := g.issueRefresh(ctx, session, stored.Family)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, rotated, nil
+}
+
+// RefreshToken trades the X-Refresh-Token request header for a new session,
+// answering with a rotated token in the same header
+func (g *Goard) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get(RefreshTokenHeader)
+	if token == "" || g.refreshTTL <= 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, rotated, err := g.refresh(r.Context(), token)
+	if err != nil {
+		if unauthenticated(err) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set(RefreshTokenHeader, rotated)
+	g.writeSession(w, r, session)
+}
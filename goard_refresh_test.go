@@ -0,0 +1,134 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signInRefresh signs in through the handler and returns the session ID and refresh token
+func signInRefresh(t *testing.T, g *Goard, login, password string) (string, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, httptest.NewRequest(http.MethodPost, "/signin",
+		strings.NewReader(`{"login":"`+login+`","password":"`+password+`"}`),
+	))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SignIn = %d, want 200", rec.Code)
+	}
+
+	token := rec.Header().Get(RefreshTokenHeader)
+	if token == "" {
+		t.Fatal("SignIn handed out no refresh token")
+	}
+	return cookieSession(g, sessionCookie(t, rec)), token
+}
+
+// trade posts a refresh token and returns the response
+func trade(g *Goard, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	r.Header.Set(RefreshTokenHeader, token)
+	rec := httptest.NewRecorder()
+	g.RefreshToken(rec, r)
+	return rec
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{RefreshTTL: time.Hour})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	sessionID, token := signInRefresh(t, g, "alice", "Secret-pass-1")
+
+	rec := trade(g, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("RefreshToken = %d, want 200", rec.Code)
+	}
+	rotated := rec.Header().Get(RefreshTokenHeader)
+	if rotated == "" || rotated == token {
+		t.Fatalf("rotated token = %q, want a new one", rotated)
+	}
+
+	// The traded session is replaced by the new one
+	if _, err := g.Authorize(ctx, sessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("Authorize traded session = %v, want ErrSessionRevoked", err)
+	}
+	fresh := cookieSession(g, sessionCookie(t, rec))
+	if _, err := g.Authorize(ctx, fresh); err != nil {
+		t.Fatalf("Authorize new session = %v", err)
+	}
+
+	if rec := trade(g, rotated); rec.Code != http.StatusOK {
+		t.Fatalf("RefreshToken with rotated token = %d, want 200", rec.Code)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	g := newTestGoard(t, &Config{RefreshTTL: time.Hour})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	_, token := signInRefresh(t, g, "alice", "Secret-pass-1")
+
+	rec := trade(g, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("RefreshToken = %d, want 200", rec.Code)
+	}
+	rotated := rec.Header().Get(RefreshTokenHeader)
+
+	// Replaying the consumed token looks like theft
+	if rec := trade(g, token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("RefreshToken reused = %d, want 401", rec.Code)
+	}
+
+	// and ends the whole family, the rotated token included
+	if rec := trade(g, rotated); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("RefreshToken of a revoked family = %d, want 401", rec.Code)
+	}
+}
+
+func TestRefreshTokenRevokedWithAccount(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{RefreshTTL: time.Hour})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	_, token := signInRefresh(t, g, "alice", "Secret-pass-1")
+
+	if err := g.RevokeAllForAccount(ctx, account); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := trade(g, token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("RefreshToken after RevokeAllForAccount = %d, want 401", rec.Code)
+	}
+}
+
+func TestRefreshTokenRevokedWithSignOut(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{RefreshTTL: time.Hour, MaxSessionsPerAccount: 3})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	phone, phoneToken := signInRefresh(t, g, "alice", "Secret-pass-1")
+	_, laptopToken := signInRefresh(t, g, "alice", "Secret-pass-1")
+
+	// The phone rotates its token once, signing out ends the rotated family
+	rec := trade(g, phoneToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("RefreshToken = %d, want 200", rec.Code)
+	}
+	phone, phoneToken = cookieSession(g, sessionCookie(t, rec)), rec.Header().Get(RefreshTokenHeader)
+
+	if err := g.signout(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+	if rec := trade(g, phoneToken); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("RefreshToken of the signed out device = %d, want 401", rec.Code)
+	}
+	if rec := trade(g, laptopToken); rec.Code != http.StatusOK {
+		t.Fatalf("RefreshToken of the other device = %d, want 200", rec.Code)
+	}
+}
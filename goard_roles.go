@@ -0,0 +1,60 @@
+package goard
+
+import (
+	"context"
+	"slices"
+)
+
+// databaseRoles is the RoleProvider keeping roles in the credentials Database
+type databaseRoles struct {
+	db Database
+}
+
+func (d databaseRoles) RolesByID(ctx context.Context, id int64) ([]string, error) {
+	credentials, err := d.db.CredentialsByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.Roles(), nil
+}
+
+func (d databaseRoles) AddRole(ctx context.Context, id int64, role string) error {
+	return d.db.AddRole(ctx, id, role)
+}
+
+func (d databaseRoles) RemoveRole(ctx context.Context, id int64, role string) error {
+	return d.db.RemoveRole(ctx, id, role)
+}
+
+func (d databaseRoles) ListRoles(ctx context.Context) ([]string, error) {
+	return d.db.ListRoles(ctx)
+}
+
+// withRoles returns credentials carrying the roles of Config.RoleProvider, if
+// one is set. The loaded credentials are left as they are, so they can still
+// be written back to the Database.
+func (g *Goard) withRoles(ctx context.Context, credentials *Credentials) (*Credentials, error) {
+	if _, ok := g.roles.(databaseRoles); ok {
+		return credentials, nil
+	}
+
+	roles, err := g.roles.RolesByID(ctx, credentials.id)
+	if err != nil {
+		return nil, err
+	}
+
+	provided := *credentials
+	provided.roles = slices.Sorted(slices.Values(roles))
+	provided.until = nil
+	return &provided, nil
+}
+
+// credentialsByID loads credentials carrying the RoleProvider roles
+func (g *Goard) credentialsByID(ctx context.Context, id int64) (*Credentials, error) {
+	credentials, err := g.database.CredentialsByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.withRoles(ctx, credentials)
+}
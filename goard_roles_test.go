@@ -0,0 +1,476 @@
+package goard
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAvailableRoles(t *testing.T) {
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	for _, role := range []string{"viewer", "editor"} {
+		if err := g.database.AddRole(context.Background(), account, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := http.HandlerFunc(g.AvailableRoles)
+
+	rec := serve(h, http.MethodGet, signInCookie(t, g, "root", "Root-pass-1"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin: %d, want 200", rec.Code)
+	}
+	var roles []string
+	if err := json.NewDecoder(rec.Body).Decode(&roles); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(roles, []string{"editor", "viewer"}) {
+		t.Fatalf("roles = %v, want [editor viewer]", roles)
+	}
+
+	if rec := serve(h, http.MethodGet, signInCookie(t, g, "alice", "Secret-pass-1")); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: %d, want 403", rec.Code)
+	}
+	if rec := serve(h, http.MethodGet, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous: %d, want 401", rec.Code)
+	}
+}
+
+func TestSingleRoleChangesKeepOtherRoles(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	if err := g.database.AddRole(ctx, account, "viewer"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := func() []string {
+		t.Helper()
+		creds, err := g.database.CredentialsByID(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds.Roles()
+	}
+
+	if err := g.setRole(ctx, admin.ID(), account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); !slices.Equal(got, []string{"editor", "viewer"}) {
+		t.Fatalf("after setRole = %v, want [editor viewer]", got)
+	}
+
+	if err := g.unsetRole(ctx, admin.ID(), account, "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if got := roles(); !slices.Equal(got, []string{"editor"}) {
+		t.Fatalf("after unsetRole = %v, want [editor]", got)
+	}
+
+	live, err := g.Authorize(ctx, alice.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(live.Roles(), []string{"editor"}) {
+		t.Fatalf("live session roles = %v, want [editor]", live.Roles())
+	}
+}
+
+func TestRoleTTLShortensLiveSession(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{TTL: 8 * time.Hour, RoleTTL: map[string]time.Duration{"sudo": time.Minute}})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	alice, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.setRole(ctx, admin.ID(), account, "sudo"); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := g.Authorize(ctx, alice.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit := time.Now().Add(time.Minute); live.ExpiresAt().After(limit) {
+		t.Fatalf("ExpiresAt = %v, want at most %v", live.ExpiresAt(), limit)
+	}
+
+	if err := g.sweep(ctx, time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Authorize(ctx, alice.ID()); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Authorize after sweep = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := g.Authorize(ctx, admin.ID()); err != nil {
+		t.Fatalf("admin session swept: %v", err)
+	}
+}
+
+func TestRolesSorted(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	alice, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"viewer", "auditor", "editor", "billing"} {
+		if err := g.setRole(ctx, admin.ID(), account, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"auditor", "billing", "editor", "viewer"}
+
+	live, err := g.Authorize(ctx, alice.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(live.Roles(), want) {
+		t.Fatalf("live session roles = %v, want %v", live.Roles(), want)
+	}
+
+	fresh, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fresh.Roles(), want) {
+		t.Fatalf("new session roles = %v, want %v", fresh.Roles(), want)
+	}
+}
+
+func TestMaxRolesPerAccount(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{MaxRolesPerAccount: 2})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"editor", "viewer"} {
+		if err := g.setRole(ctx, admin.ID(), account, role); err != nil {
+			t.Fatalf("grant %s under the cap: %v", role, err)
+		}
+	}
+	if err := g.setRole(ctx, admin.ID(), account, "auditor"); !errors.Is(err, ErrTooManyRoles) {
+		t.Fatalf("grant past the cap = %v, want ErrTooManyRoles", err)
+	}
+	if err := g.SetRoleUntil(ctx, account, "auditor", time.Now().Add(time.Hour)); !errors.Is(err, ErrTooManyRoles) {
+		t.Fatalf("time-boxed grant past the cap = %v, want ErrTooManyRoles", err)
+	}
+}
+
+func TestLastAdminKeepsRole(t *testing.T) {
+	ctx := context.Background()
+	for _, protected := range []string{"", "owner"} {
+		g := newTestGoard(t, &Config{ProtectedRole: protected})
+		role := cmp.Or(protected, "admin")
+		alice := signUpAccount(t, g, "alice", "Secret-pass-1")
+		bob := signUpAccount(t, g, "bob", "Secret-pass-1")
+
+		admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, account := range []int64{alice, bob} {
+			if err := g.setRole(ctx, admin.ID(), account, role); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := g.unsetRole(ctx, admin.ID(), bob, role); err != nil {
+			t.Fatalf("%s: removing from one of two holders: %v", role, err)
+		}
+		if err := g.unsetRole(ctx, admin.ID(), alice, role); !errors.Is(err, ErrLastAdmin) {
+			t.Fatalf("%s: removing from the last holder = %v, want ErrLastAdmin", role, err)
+		}
+
+		creds, err := g.database.CredentialsByID(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(creds.Roles(), role) {
+			t.Fatalf("%s: last holder lost the role, roles %v", role, creds.Roles())
+		}
+	}
+}
+
+func TestTimeBoxedRole(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+	alice, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(100 * time.Millisecond)
+	if err := g.SetRoleUntil(ctx, account, "contractor", until); err != nil {
+		t.Fatal(err)
+	}
+
+	held := func() (stored, live []string) {
+		t.Helper()
+		creds, err := g.database.CredentialsByID(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := g.Authorize(ctx, alice.ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds.Roles(), session.Roles()
+	}
+
+	if stored, live := held(); !slices.Equal(stored, []string{"contractor"}) || !slices.Equal(live, []string{"contractor"}) {
+		t.Fatalf("active grant: stored %v, live %v", stored, live)
+	}
+
+	time.Sleep(time.Until(until) + 10*time.Millisecond)
+
+	if stored, live := held(); len(stored) != 0 || len(live) != 0 {
+		t.Fatalf("expired grant: stored %v, live %v", stored, live)
+	}
+
+	if err := g.sweep(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.metrics.permissions.Load(); n != 1 {
+		t.Fatalf("sweep deleted %d permission rows, want 1", n)
+	}
+}
+
+func TestRoleChangePolicies(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		policy RoleChangePolicy
+		change func(*Goard) error
+		roles  []string
+	}{
+		{"refresh rename", RoleChangeRefresh, func(g *Goard) error { return g.RenameRole(ctx, "editor", "writer") }, []string{"viewer", "writer"}},
+		{"refresh delete", RoleChangeRefresh, func(g *Goard) error { return g.DeleteRole(ctx, "editor") }, []string{"viewer"}},
+		{"on guard rename", RoleChangeOnGuard, func(g *Goard) error { return g.RenameRole(ctx, "editor", "writer") }, []string{"viewer", "writer"}},
+		{"on guard delete", RoleChangeOnGuard, func(g *Goard) error { return g.DeleteRole(ctx, "editor") }, []string{"viewer"}},
+		{"revoke rename", RoleChangeRevoke, func(g *Goard) error { return g.RenameRole(ctx, "editor", "writer") }, nil},
+		{"revoke delete", RoleChangeRevoke, func(g *Goard) error { return g.DeleteRole(ctx, "editor") }, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGoard(t, &Config{RoleChange: tc.policy})
+			account := signUpAccount(t, g, "alice", "Secret-pass-1")
+			for _, role := range []string{"editor", "viewer"} {
+				if err := g.database.AddRole(ctx, account, role); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+
+			if err := tc.change(g); err != nil {
+				t.Fatal(err)
+			}
+
+			var roles []string
+			h := g.Guard(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				session, _ := SessionFromContext(r.Context())
+				roles = session.Roles()
+			}), func(*Session) bool { return true })
+
+			rec := serve(h, http.MethodGet, cookie)
+			if tc.roles == nil {
+				if rec.Code != http.StatusUnauthorized {
+					t.Fatalf("Guard = %d, want 401 for a revoked session", rec.Code)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Guard = %d, want 200", rec.Code)
+			}
+			if !slices.Equal(roles, tc.roles) {
+				t.Fatalf("roles = %v, want %v", roles, tc.roles)
+			}
+		})
+	}
+}
+
+// tenantAdminApp lets "manager" role holders manage the roles of their own tenant
+type tenantAdminApp struct {
+	*testApp
+	tenants map[int64]string
+}
+
+func (a *tenantAdminApp) CanManageRoles(_ context.Context, actor *Session, account int64) (bool, error) {
+	if actor.IsAdmin() {
+		return true, nil
+	}
+	if !slices.Contains(actor.Roles(), "manager") {
+		return false, nil
+	}
+	return a.tenants[actor.Account().GetID()] == a.tenants[account], nil
+}
+
+func TestDelegatedRoleManagement(t *testing.T) {
+	ctx := context.Background()
+	app := &tenantAdminApp{testApp: &testApp{}}
+	g := newTestGoard(t, &Config{App: app})
+
+	alice := signUpAccount(t, g, "alice", "Secret-pass-1")
+	bob := signUpAccount(t, g, "bob", "Secret-pass-1")
+	carol := signUpAccount(t, g, "carol", "Secret-pass-1")
+	app.tenants = map[int64]string{alice: "acme", bob: "acme", carol: "globex"}
+	if err := g.database.AddRole(ctx, alice, "manager"); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+	setRole := func(account int64) int {
+		r := request(http.MethodPatch, `{"account":`+strconv.FormatInt(account, 10)+`,"role":"editor"}`)
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		g.SetRole(rec, r)
+		return rec.Code
+	}
+
+	if code := setRole(bob); code != http.StatusOK {
+		t.Fatalf("within the tenant: %d, want 200", code)
+	}
+	if code := setRole(carol); code != http.StatusForbidden {
+		t.Fatalf("outside the tenant: %d, want 403", code)
+	}
+
+	for account, want := range map[int64][]string{bob: {"editor"}, carol: nil} {
+		creds, err := g.database.CredentialsByID(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(creds.Roles(), want) {
+			t.Errorf("account %d roles = %v, want %v", account, creds.Roles(), want)
+		}
+	}
+
+	// The superuser still manages every tenant
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.setRole(ctx, admin.ID(), carol, "editor"); err != nil {
+		t.Fatalf("admin outside any tenant: %v", err)
+	}
+}
+
+// mapRoles serves roles from memory, as an external authorization service would
+type mapRoles struct {
+	mu    sync.Mutex
+	roles map[int64][]string
+}
+
+func (m *mapRoles) RolesByID(_ context.Context, id int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.roles[id]), nil
+}
+
+func (m *mapRoles) AddRole(_ context.Context, id int64, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.roles[id], role) {
+		m.roles[id] = append(m.roles[id], role)
+	}
+	return nil
+}
+
+func (m *mapRoles) RemoveRole(_ context.Context, id int64, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roles[id] = slices.DeleteFunc(m.roles[id], func(r string) bool { return r == role })
+	return nil
+}
+
+func (m *mapRoles) ListRoles(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var roles []string
+	for _, granted := range m.roles {
+		roles = append(roles, granted...)
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles), nil
+}
+
+func TestRoleProvider(t *testing.T) {
+	ctx := context.Background()
+	provider := &mapRoles{roles: map[int64][]string{1: {"viewer"}}}
+	g := newTestGoard(t, &Config{RoleProvider: provider})
+	account := signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	alice, err := g.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(alice.Roles(), []string{"viewer"}) {
+		t.Fatalf("session roles = %v, want the provider's [viewer]", alice.Roles())
+	}
+
+	admin, err := g.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.setRole(ctx, admin.ID(), account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := provider.RolesByID(ctx, account); !slices.Equal(got, []string{"viewer", "editor"}) {
+		t.Fatalf("provider roles = %v, want [viewer editor]", got)
+	}
+	live, err := g.Authorize(ctx, alice.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(live.Roles(), []string{"editor", "viewer"}) {
+		t.Fatalf("live session roles = %v, want [editor viewer]", live.Roles())
+	}
+
+	// The database keeps no roles
+	creds, err := g.database.CredentialsByID(ctx, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds.Roles()) != 0 {
+		t.Fatalf("database roles = %v, want none", creds.Roles())
+	}
+
+	if roles, err := g.availableRoles(ctx, admin.ID()); err != nil || !slices.Equal(roles, []string{"editor", "viewer"}) {
+		t.Fatalf("available roles = %v, %v, want [editor viewer]", roles, err)
+	}
+}
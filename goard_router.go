@@ -0,0 +1,273 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// shardedDatabase routes every call to the database of the context tenant
+type shardedDatabase struct {
+	shards   map[string]Database
+	fallback Database
+}
+
+// route returns the database of the context tenant, falling back to noShard
+// when there is no fallback
+func (s *shardedDatabase) route(ctx context.Context) Database {
+	if db, ok := s.shards[TenantFromContext(ctx)]; ok {
+		return db
+	}
+	if s.fallback == nil {
+		return noShard{}
+	}
+	return s.fallback
+}
+
+// Migrate implements Database.
+func (s *shardedDatabase) Migrate(ctx context.Context) error {
+	var errs []error
+	for _, db := range s.shards {
+		errs = append(errs, db.Migrate(ctx))
+	}
+	if s.fallback != nil {
+		errs = append(errs, s.fallback.Migrate(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// CredentialsByLogin implements Database.
+func (s *shardedDatabase) CredentialsByLogin(ctx context.Context, login string) (*Credentials, error) {
+	return s.route(ctx).CredentialsByLogin(ctx, login)
+}
+
+// CreateCredentials implements Database.
+func (s *shardedDatabase) CreateCredentials(ctx context.Context, credentials *Credentials) error {
+	return s.route(ctx).CreateCredentials(ctx, credentials)
+}
+
+// CredentialsByID implements Database.
+func (s *shardedDatabase) CredentialsByID(ctx context.Context, id int64) (*Credentials, error) {
+	return s.route(ctx).CredentialsByID(ctx, id)
+}
+
+// DeleteCredentials implements Database.
+func (s *shardedDatabase) DeleteCredentials(ctx context.Context, id int64) error {
+	return s.route(ctx).DeleteCredentials(ctx, id)
+}
+
+// UpdateCredentials implements Database.
+func (s *shardedDatabase) UpdateCredentials(ctx context.Context, credentials *Credentials) error {
+	return s.route(ctx).UpdateCredentials(ctx, credentials)
+}
+
+// ListRoles implements Database.
+func (s *shardedDatabase) ListRoles(ctx context.Context) ([]string, error) {
+	return s.route(ctx).ListRoles(ctx)
+}
+
+// AddRole implements Database.
+func (s *shardedDatabase) AddRole(ctx context.Context, id int64, role string) error {
+	return s.route(ctx).AddRole(ctx, id, role)
+}
+
+// AddRoleUntil implements Database.
+func (s *shardedDatabase) AddRoleUntil(ctx context.Context, id int64, role string, until time.Time) error {
+	return s.route(ctx).AddRoleUntil(ctx, id, role, until)
+}
+
+// RemoveRole implements Database.
+func (s *shardedDatabase) RemoveRole(ctx context.Context, id int64, role string) error {
+	return s.route(ctx).RemoveRole(ctx, id, role)
+}
+
+// CountRole implements Database.
+func (s *shardedDatabase) CountRole(ctx context.Context, role string) (int, error) {
+	return s.route(ctx).CountRole(ctx, role)
+}
+
+// DeleteExpiredPermissions implements Database. Every shard is swept.
+func (s *shardedDatabase) DeleteExpiredPermissions(ctx context.Context) (int64, error) {
+	var (
+		total int64
+		errs  []error
+	)
+	for _, db := range s.shards {
+		n, err := db.DeleteExpiredPermissions(ctx)
+		total += n
+		errs = append(errs, err)
+	}
+	if s.fallback != nil {
+		n, err := s.fallback.DeleteExpiredPermissions(ctx)
+		total += n
+		errs = append(errs, err)
+	}
+	return total, errors.Join(errs...)
+}
+
+// RenameRole implements Database. Every shard is updated, the role only has to exist in one.
+func (s *shardedDatabase) RenameRole(ctx context.Context, from, to string) error {
+	return s.everywhere(func(db Database) error {
+		return db.RenameRole(ctx, from, to)
+	})
+}
+
+// DeleteRole implements Database. Every shard is updated, the role only has to exist in one.
+func (s *shardedDatabase) DeleteRole(ctx context.Context, role string) error {
+	return s.everywhere(func(db Database) error {
+		return db.DeleteRole(ctx, role)
+	})
+}
+
+// everywhere runs a role change on all databases, reporting ErrRoleNotFound
+// only when no database knows the role
+func (s *shardedDatabase) everywhere(change func(Database) error) error {
+	all := make([]Database, 0, len(s.shards)+1)
+	for _, db := range s.shards {
+		all = append(all, db)
+	}
+	if s.fallback != nil {
+		all = append(all, s.fallback)
+	}
+
+	var (
+		found bool
+		errs  []error
+	)
+	for _, db := range all {
+		if err := change(db); errors.Is(err, ErrRoleNotFound) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+		found = true
+	}
+
+	if !found {
+		return ErrRoleNotFound
+	}
+	return errors.Join(errs...)
+}
+
+// AddPermission implements PermissionDatabase.
+func (s *shardedDatabase) AddPermission(ctx context.Context, id int64, permission string) error {
+	db, ok := s.route(ctx).(PermissionDatabase)
+	if !ok {
+		return ErrNoPermissions
+	}
+	return db.AddPermission(ctx, id, permission)
+}
+
+// RemovePermission implements PermissionDatabase.
+func (s *shardedDatabase) RemovePermission(ctx context.Context, id int64, permission string) error {
+	db, ok := s.route(ctx).(PermissionDatabase)
+	if !ok {
+		return ErrNoPermissions
+	}
+	return db.RemovePermission(ctx, id, permission)
+}
+
+// ForEachCredentials implements Database. Every shard is visited with its tenant on the context, the fallback last.
+func (s *shardedDatabase) ForEachCredentials(ctx context.Context, callback func(*Credentials) error) error {
+	for tenant, db := range s.shards {
+		if err := db.ForEachCredentials(WithTenant(ctx, tenant), callback); err != nil {
+			return err
+		}
+	}
+	if s.fallback != nil {
+		return s.fallback.ForEachCredentials(ctx, callback)
+	}
+	return nil
+}
+
+// UpdatePasshash implements Database.
+func (s *shardedDatabase) UpdatePasshash(ctx context.Context, id int64, passhash string) error {
+	return s.route(ctx).UpdatePasshash(ctx, id, passhash)
+}
+
+// SetMustChangePassword implements Database.
+func (s *shardedDatabase) SetMustChangePassword(ctx context.Context, id int64, must bool) error {
+	return s.route(ctx).SetMustChangePassword(ctx, id, must)
+}
+
+// noShard stands in for the database of a tenant without one, failing with
+// ErrUnknownTenant instead of a nil Database
+type noShard struct{}
+
+func (noShard) Migrate(context.Context) error {
+	return nil
+}
+
+func (noShard) CredentialsByLogin(context.Context, string) (*Credentials, error) {
+	return nil, ErrUnknownTenant
+}
+
+func (noShard) CreateCredentials(context.Context, *Credentials) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) CredentialsByID(context.Context, int64) (*Credentials, error) {
+	return nil, ErrUnknownTenant
+}
+
+func (noShard) DeleteCredentials(context.Context, int64) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) UpdateCredentials(context.Context, *Credentials) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) UpdatePasshash(context.Context, int64, string) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) ListRoles(context.Context) ([]string, error) {
+	return nil, ErrUnknownTenant
+}
+
+func (noShard) AddRole(context.Context, int64, string) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) AddRoleUntil(context.Context, int64, string, time.Time) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) RemoveRole(context.Context, int64, string) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) CountRole(context.Context, string) (int, error) {
+	return 0, ErrUnknownTenant
+}
+
+func (noShard) DeleteExpiredPermissions(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (noShard) RenameRole(context.Context, string, string) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) DeleteRole(context.Context, string) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) ForEachCredentials(context.Context, func(*Credentials) error) error {
+	return ErrUnknownTenant
+}
+
+func (noShard) SetMustChangePassword(context.Context, int64, bool) error {
+	return ErrUnknownTenant
+}
+
+// NewShardedDatabase routes calls by the tenant of their context (see WithTenant
+// and Session.Shard), unknown tenants go to fallback. Without fallback, calls
+// for an unknown tenant or a context without tenant fail with ErrUnknownTenant.
+func NewShardedDatabase(shards map[string]Database, fallback Database) Database {
+	return &shardedDatabase{
+		shards:   shards,
+		fallback: fallback,
+	}
+}
@@ -0,0 +1,72 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingStore refuses to revoke sessions
+type failingStore struct {
+	*store
+}
+
+func (s *failingStore) RevokeSession(context.Context, string) error {
+	return errors.New("store unavailable")
+}
+
+func TestSignOut(t *testing.T) {
+	signOut := func(g *Goard, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/signout", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		g.SignOut(rec, r)
+		return rec
+	}
+
+	t.Run("revoked", func(t *testing.T) {
+		g := newTestGoard(t, &Config{})
+		signUpAccount(t, g, "alice", "Alice-pass-1")
+		cookie := signInCookie(t, g, "alice", "Alice-pass-1")
+
+		rec := signOut(g, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("SignOut = %d, want 200", rec.Code)
+		}
+
+		cleared := false
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "sid" && c.MaxAge < 0 {
+				cleared = true
+			}
+		}
+		if !cleared {
+			t.Fatal("SignOut did not clear the session cookie")
+		}
+
+		if _, err := g.session(context.Background(), cookieSession(g, cookie)); !errors.Is(err, ErrSessionRevoked) {
+			t.Fatalf("session after SignOut: %v, want ErrSessionRevoked", err)
+		}
+	})
+
+	t.Run("no session", func(t *testing.T) {
+		g := newTestGoard(t, &Config{})
+		if rec := signOut(g, nil); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("SignOut = %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("revoke fails", func(t *testing.T) {
+		g := newTestGoard(t, &Config{Store: &failingStore{store: NewStore()}})
+		signUpAccount(t, g, "alice", "Alice-pass-1")
+		cookie := signInCookie(t, g, "alice", "Alice-pass-1")
+
+		if rec := signOut(g, cookie); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("SignOut = %d, want 500", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccountPreprocessor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rejects", func(t *testing.T) {
+		app := &testApp{}
+		g := newTestGoard(t, &Config{App: app, AccountPreprocessor: func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			return nil, errors.New("email missing")
+		}})
+
+		if _, err := g.signup(ctx, json.RawMessage(`{}`), "alice", "Secret-pass-1"); !errors.Is(err, ErrBadCredentials) {
+			t.Fatalf("signup = %v, want ErrBadCredentials", err)
+		}
+		if len(app.accounts) != 0 {
+			t.Fatal("App account created for a rejected payload")
+		}
+	})
+
+	t.Run("rewrites", func(t *testing.T) {
+		app := &testApp{}
+		g := newTestGoard(t, &Config{App: app, AccountPreprocessor: func(_ context.Context, raw json.RawMessage) (json.RawMessage, error) {
+			var account map[string]any
+			if err := json.Unmarshal(raw, &account); err != nil {
+				return nil, err
+			}
+			delete(account, "admin")
+			account["plan"] = "free"
+			return json.Marshal(account)
+		}})
+
+		account, err := g.signup(ctx, json.RawMessage(`{"name":"Alice","admin":true}`), "alice", "Secret-pass-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(app.accounts[account.GetID()]); got != `{"name":"Alice","plan":"free"}` {
+			t.Fatalf("App received %s", got)
+		}
+	})
+}
+
+// brokenDatabase fails to create credentials
+type brokenDatabase struct {
+	Database
+}
+
+func (d *brokenDatabase) CreateCredentials(context.Context, *Credentials) error {
+	return errors.New("database unavailable")
+}
+
+// flakyApp fails the first account deletions, as many as failures
+type flakyApp struct {
+	*testApp
+	mu       sync.Mutex
+	failures int
+	deleted  chan int64
+}
+
+func (a *flakyApp) DeleteAccount(ctx context.Context, id int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return errors.New("app unavailable")
+	}
+	if err := a.testApp.DeleteAccount(ctx, id); err != nil {
+		return err
+	}
+	a.deleted <- id
+	return nil
+}
+
+// fullQueue refuses every orphan
+type fullQueue struct{}
+
+func (fullQueue) Enqueue(context.Context, int64) error {
+	return errors.New("queue full")
+}
+
+func (fullQueue) Run(context.Context, func(context.Context, int64) error) {}
+
+// reaperFunc adapts a function to OrphanReaper
+type reaperFunc func(ctx context.Context, account int64, err error)
+
+func (f reaperFunc) Reap(ctx context.Context, account int64, err error) {
+	f(ctx, account, err)
+}
+
+func TestSignUpRollbackFailureReachesReaper(t *testing.T) {
+	var reaped []int64
+	g := newTestGoard(t, &Config{
+		App:         &flakyApp{testApp: &testApp{}, failures: 1, deleted: make(chan int64, 1)},
+		Database:    &brokenDatabase{Database: newTestDatabase(t)},
+		OrphanQueue: fullQueue{},
+		OrphanReaper: reaperFunc(func(_ context.Context, account int64, err error) {
+			reaped = append(reaped, account)
+		}),
+	})
+
+	account, err := g.signup(context.Background(), json.RawMessage(`{}`), "alice", "Secret-pass-1")
+	if err == nil {
+		t.Fatalf("signup = %v, want an error", account)
+	}
+	if len(reaped) != 1 || reaped[0] != 1 {
+		t.Fatalf("reaped = %v, want [1]", reaped)
+	}
+}
+
+// welcomeAccount is an app account carrying fields chosen at creation
+type welcomeAccount struct {
+	ID    int64  `json:"id"`
+	Token string `json:"welcome_token"`
+}
+
+func (a welcomeAccount) GetID() int64 {
+	return a.ID
+}
+
+// welcomeApp hands out a welcome token with every account it creates
+type welcomeApp struct {
+	*testApp
+}
+
+func (a *welcomeApp) CreateAccount(ctx context.Context, raw json.RawMessage) (Account, error) {
+	account, err := a.testApp.CreateAccount(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	return welcomeAccount{ID: account.GetID(), Token: "welcome-" + strconv.FormatInt(account.GetID(), 10)}, nil
+}
+
+func TestSignUpReturnsAccount(t *testing.T) {
+	for _, returned := range []bool{false, true} {
+		g := newTestGoard(t, &Config{App: &welcomeApp{testApp: &testApp{}}, ReturnAccount: returned})
+
+		rec := httptest.NewRecorder()
+		g.SignUp(rec, request(http.MethodPost, `{"account":{},"login":"alice","password":"Secret-pass-1"}`))
+
+		if !returned {
+			if rec.Body.Len() != 0 {
+				t.Fatalf("body %q without ReturnAccount", rec.Body.String())
+			}
+			continue
+		}
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("SignUp = %d, want 201", rec.Code)
+		}
+		var account welcomeAccount
+		if err := json.NewDecoder(rec.Body).Decode(&account); err != nil {
+			t.Fatal(err)
+		}
+		if account != (welcomeAccount{ID: 1, Token: "welcome-1"}) {
+			t.Fatalf("account = %+v, want the app representation", account)
+		}
+	}
+}
+
+func TestSignUpRollbackRetried(t *testing.T) {
+	app := &flakyApp{testApp: &testApp{}, failures: 1, deleted: make(chan int64, 1)}
+	g := newTestGoard(t, &Config{App: app, Database: &brokenDatabase{Database: newTestDatabase(t)}})
+	if err := g.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if _, err := g.signup(context.Background(), json.RawMessage(`{}`), "alice", "Secret-pass-1"); err == nil {
+		t.Fatal("signup succeeded without credentials")
+	}
+
+	// The synchronous rollback failed, the queue retries after its backoff
+	select {
+	case id := <-app.deleted:
+		if id != 1 {
+			t.Fatalf("deleted account %d, want 1", id)
+		}
+	case <-time.After(orphanBackoff + 2*time.Second):
+		t.Fatal("orphaned account never deleted")
+	}
+	if len(app.accounts) != 0 {
+		t.Fatalf("%d app accounts left", len(app.accounts))
+	}
+}
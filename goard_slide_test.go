@@ -0,0 +1,86 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlideKeepsRevokedSessionRevoked(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{TTL: time.Hour})
+
+	session := &Session{id: "s1", iss: time.Now(), exp: time.Now().Add(time.Minute)}
+	if err := g.store.CreateSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.revoke(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	slid, err := g.slide(ctx, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slid != session {
+		t.Fatal("slide extended a revoked session")
+	}
+	if _, err := g.store.InvokeSession(ctx, "s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("InvokeSession after slide = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestStoreUpdateSessionMissing(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+
+	if err := s.UpdateSession(ctx, &Session{id: "s1"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("UpdateSession = %v, want ErrSessionNotFound", err)
+	}
+	if n := s.Count(ctx); n != 0 {
+		t.Fatalf("Count = %d, want 0", n)
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	const ttl = 150 * time.Millisecond
+	g := newTestGoard(t, &Config{TTL: ttl, SlidingExpiration: true, MaxLifetime: 600 * time.Millisecond})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	h := g.Guard(okHandler, func(*Session) bool { return true })
+
+	// Activity carries the session well past its first TTL
+	cookie := signInCookie(t, g, "alice", "Secret-pass-1")
+	start := time.Now()
+	for time.Since(start) < 3*ttl {
+		rec := serve(h, http.MethodGet, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("active session after %v: %d, want 200", time.Since(start), rec.Code)
+		}
+		if c := rec.Result().Cookies(); len(c) > 0 {
+			cookie = c[0]
+		}
+		time.Sleep(ttl / 3)
+	}
+
+	// Up to the max lifetime only
+	for time.Since(start) < 600*time.Millisecond {
+		serve(h, http.MethodGet, cookie)
+		time.Sleep(ttl / 3)
+	}
+	time.Sleep(ttl / 3)
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("past the max lifetime: %d, want 401", rec.Code)
+	}
+
+	// Idleness lets it die
+	cookie = signInCookie(t, g, "alice", "Secret-pass-1")
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("fresh session: %d, want 200", rec.Code)
+	}
+	time.Sleep(ttl + 20*time.Millisecond)
+	if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("idle session: %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// sessionRecord is the serialized form of a Session. Account data is not
+// stored: it is fetched back from the App on load. Serialized times lose
+// their monotonic reading, so restored sessions expire by wall clock.
+type sessionRecord struct {
+	ID        string               `json:"id"`
+	Account   int64                `json:"account"`
+	Login     string               `json:"login"`
+	Roles     []string             `json:"roles,omitempty"`
+	RolesTill map[string]time.Time `json:"roles_until,omitempty"`
+	ExpiresAt time.Time            `json:"exp"`
+	IssuedAt  time.Time            `json:"iss"`
+	Admin     bool                 `json:"admin,omitempty"`
+	State     SessionState         `json:"state,omitempty"`
+	Shard     string               `json:"shard,omitempty"`
+	Scopes    []string             `json:"scopes,omitempty"`
+	Perms     []string             `json:"perms,omitempty"`
+	Must      bool                 `json:"must_change_password,omitempty"`
+}
+
+// DrainTo stops Goard like Close and writes every active, non-expired session to w
+func (g *Goard) DrainTo(ctx context.Context, w io.Writer) error {
+	if err := g.Close(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	encoder := json.NewEncoder(w)
+
+	return g.store.ForEach(ctx, func(s *Session) error {
+		if !s.exp.After(now) || s.credentials == nil {
+			return nil
+		}
+
+		return encoder.Encode(&sessionRecord{
+			ID:        s.id,
+			Account:   s.credentials.id,
+			Login:     s.credentials.login,
+			Roles:     s.credentials.roles,
+			RolesTill: s.credentials.until,
+			ExpiresAt: s.exp,
+			IssuedAt:  s.iss,
+			Admin:     s.admin,
+			State:     s.state,
+			Shard:     s.shard,
+			Scopes:    s.scopes,
+			Perms:     s.credentials.permissions,
+			Must:      s.credentials.mustChange,
+		})
+	})
+}
+
+// LoadFrom restores sessions written by DrainTo, skipping the expired ones
+func (g *Goard) LoadFrom(ctx context.Context, r io.Reader) error {
+	now := time.Now()
+	decoder := json.NewDecoder(r)
+
+	for {
+		var rec sessionRecord
+		if err := decoder.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if !rec.ExpiresAt.After(now) {
+			continue
+		}
+
+		var account Account
+		if rec.Account == 0 {
+			account = g.superuser().Account
+		} else {
+			var err error
+			if account, err = g.app.AccountByID(WithTenant(ctx, rec.Shard), rec.Account); err != nil {
+				return err
+			}
+		}
+
+		if err := g.store.CreateSession(ctx, &Session{
+			id:      rec.ID,
+			account: account,
+			credentials: &Credentials{
+				id:          rec.Account,
+				login:       rec.Login,
+				roles:       rec.Roles,
+				until:       rec.RolesTill,
+				permissions: rec.Perms,
+				mustChange:  rec.Must,
+			},
+			exp:       rec.ExpiresAt,
+			iss:       rec.IssuedAt,
+			admin:     rec.Admin,
+			state:     rec.State,
+			shard:     rec.Shard,
+			scopes:    rec.Scopes,
+			hierarchy: g.hierarchy,
+		}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package goard
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDrainAndLoadAcrossRestart(t *testing.T) {
+	ctx := context.Background()
+	app, db := &testApp{}, newTestDatabase(t)
+
+	before := newTestGoard(t, &Config{App: app, Database: db})
+	account := signUpAccount(t, before, "alice", "Secret-pass-1")
+	if err := db.AddRole(ctx, account, "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := before.AuthenticatePassword(ctx, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := before.AuthenticatePassword(ctx, "root", "Root-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot bytes.Buffer
+	if err := before.DrainTo(ctx, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	after := newTestGoard(t, &Config{App: app, Database: db})
+	if err := after.LoadFrom(ctx, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := after.Authorize(ctx, alice.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Account().GetID() != account || !slices.Equal(restored.Roles(), []string{"editor"}) {
+		t.Fatalf("restored session = account %d roles %v", restored.Account().GetID(), restored.Roles())
+	}
+	if !restored.ExpiresAt().Equal(alice.ExpiresAt()) {
+		t.Fatalf("restored expiry = %v, want %v", restored.ExpiresAt(), alice.ExpiresAt())
+	}
+
+	restoredAdmin, err := after.Authorize(ctx, admin.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restoredAdmin.IsAdmin() {
+		t.Fatal("restored admin session lost its admin flag")
+	}
+}
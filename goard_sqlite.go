@@ -0,0 +1,770 @@
+package goard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// sqliteDatabase stores times in UTC so they compare as text
+type sqliteDatabase struct {
+	db      *sql.DB
+	options DatabaseOptions
+}
+
+func (s *sqliteDatabase) Migrate(ctx context.Context) error {
+	const query = `
+	CREATE TABLE IF NOT EXISTS 
+		goard_roles (
+			role_id INTEGER PRIMARY KEY,
+			role_name VARCHAR(60) NOT NULL
+		)
+	;
+
+	CREATE TABLE IF NOT EXISTS 
+		goard_creds (
+			creds_id INTEGER NOT NULL UNIQUE,
+			creds_tenant VARCHAR(60) NOT NULL DEFAULT '',
+			creds_login VARCHAR(60) NOT NULL,
+			creds_passhash VARCHAR(120) NOT NULL,
+			creds_must_change BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)
+	;
+
+	CREATE UNIQUE INDEX IF NOT EXISTS
+		goard_creds_tenant_login
+	ON
+		goard_creds (creds_tenant, creds_login)
+	;
+
+	CREATE TABLE IF NOT EXISTS 
+		goard_permissions (
+			creds_id INTEGER NOT NULL REFERENCES goard_creds(creds_id),
+			role_id INTEGER NOT NULL REFERENCES goard_roles(role_id),
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME
+		)
+	;
+
+	CREATE TABLE IF NOT EXISTS 
+		goard_creds_permissions (
+			creds_id INTEGER NOT NULL REFERENCES goard_creds(creds_id),
+			permission VARCHAR(120) NOT NULL,
+			created_at DATETIME NOT NULL,
+			UNIQUE (creds_id, permission)
+		)
+	;`
+
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteDatabase) createRoleIfNotExists(ctx context.Context, tx *sql.Tx, role string) (int32, error) {
+	var id int32
+
+	if err := tx.QueryRowContext(ctx,
+		`SELECT role_id FROM goard_roles WHERE role_name = ?;`,
+		role,
+	).Scan(&id); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	} else {
+		return id, nil
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO goard_roles (role_name) VALUES (?);`,
+		role,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	last, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(last), nil
+}
+
+// permissionsByCredentialsID returns the sorted fine grained permissions
+func (s *sqliteDatabase) permissionsByCredentialsID(ctx context.Context, tx *sql.Tx, credsID int64) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT permission FROM goard_creds_permissions WHERE creds_id = ? ORDER BY permission;`,
+		credsID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AddPermission implements PermissionDatabase.
+func (s *sqliteDatabase) AddPermission(ctx context.Context, credsID int64, permission string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO goard_creds_permissions (creds_id, permission, created_at) VALUES (?, ?, ?);`,
+		credsID, permission, time.Now().UTC(),
+	)
+	return err
+}
+
+// RemovePermission implements PermissionDatabase.
+func (s *sqliteDatabase) RemovePermission(ctx context.Context, credsID int64, permission string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM goard_creds_permissions WHERE creds_id = ? AND permission = ?;`,
+		credsID, permission,
+	)
+	return err
+}
+
+// rolesByCredentialsID returns live grants and the expiry of the time-boxed ones.
+func (s *sqliteDatabase) rolesByCredentialsID(ctx context.Context, tx *sql.Tx, credsID int64) ([]string, map[string]time.Time, error) {
+	const query = `
+	SELECT
+		goard_roles.role_name,
+		goard_permissions.expires_at
+	FROM
+		goard_permissions
+	JOIN 
+		goard_roles 
+	ON 
+		goard_permissions.role_id = goard_roles.role_id
+	WHERE
+		goard_permissions.creds_id = ?
+	AND
+		(goard_permissions.expires_at IS NULL OR goard_permissions.expires_at > ?)
+	ORDER BY
+		goard_roles.role_name;`
+
+	rows, err := tx.QueryContext(ctx, query, credsID, time.Now().UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	var until map[string]time.Time
+
+	for rows.Next() {
+		var (
+			role    string
+			expires sql.NullTime
+		)
+		if err = rows.Scan(&role, &expires); err != nil {
+			return nil, nil, err
+		}
+		roles = append(roles, role)
+
+		if expires.Valid {
+			if until == nil {
+				until = map[string]time.Time{}
+			}
+			until[role] = expires.Time
+		}
+	}
+
+	return roles, until, rows.Err()
+}
+
+// createPermission grants the role. Only AddRole sets permanent to turn an
+// existing time-boxed grant permanent, diffs such as UpdateCredentials leave an
+// existing grant alone so a stale role list can't revive a lapsed one.
+func (s *sqliteDatabase) createPermission(ctx context.Context, tx *sql.Tx, credsID int64, roleID int32, permanent bool) error {
+	if permanent {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE goard_permissions SET expires_at = NULL WHERE creds_id = ? AND role_id = ?;`,
+			credsID, roleID,
+		)
+		if err != nil {
+			return err
+		}
+
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			return nil
+		}
+	} else {
+		var ok int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT 1 FROM goard_permissions WHERE creds_id = ? AND role_id = ?;`,
+			credsID, roleID,
+		).Scan(&ok); err == nil {
+			return nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO goard_permissions (creds_id, role_id, created_at) VALUES (?, ?, ?);`,
+		credsID, roleID, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteDatabase) deletePermission(ctx context.Context, tx *sql.Tx, credsID int64, role string) error {
+	const query = `
+	DELETE FROM
+	    goard_permissions
+	WHERE
+	    creds_id = ?
+	AND
+	    role_id IN (SELECT role_id FROM goard_roles WHERE role_name = ?);`
+
+	if _, err := tx.ExecContext(ctx, query, credsID, role); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateCredentials implements Database.
+func (s *sqliteDatabase) CreateCredentials(ctx context.Context, credentials *Credentials) error {
+	const query = `
+	INSERT INTO 
+		goard_creds (
+			creds_id,
+			creds_tenant,
+			creds_login,
+			creds_passhash,
+			created_at,
+			updated_at
+		) 
+	VALUES 
+		(?, ?, ?, ?, ?, ?);`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, query,
+		credentials.id,
+		credentials.tenant,
+		credentials.login,
+		credentials.passhash,
+		now,
+		now,
+	); err != nil {
+		return err
+	}
+
+	credsID := credentials.id
+
+	for i := range credentials.roles {
+		roleID, err := s.createRoleIfNotExists(ctx, tx, credentials.roles[i])
+		if err != nil {
+			return err
+		}
+		if err = s.createPermission(ctx, tx, credsID, roleID, false); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CredentialsByID implements Database.
+func (s *sqliteDatabase) CredentialsByID(ctx context.Context, credsID int64) (*Credentials, error) {
+	const query = `
+	SELECT
+		creds_id,
+		creds_tenant,
+		creds_login,
+		creds_passhash,
+		creds_must_change
+	FROM
+		goard_creds
+	WHERE
+		creds_id = ?;`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	creds := &Credentials{}
+	if err = tx.QueryRowContext(ctx, query, credsID).Scan(
+		&creds.id,
+		&creds.tenant,
+		&creds.login,
+		&creds.passhash,
+		&creds.mustChange,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCredentialsNotFound
+		}
+		return nil, err
+	}
+
+	if creds.roles, creds.until, err = s.rolesByCredentialsID(ctx, tx, credsID); err != nil {
+		return nil, err
+	}
+
+	if creds.permissions, err = s.permissionsByCredentialsID(ctx, tx, credsID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// CredentialsByLogin implements Database. The lookup is scoped to the context tenant.
+func (s *sqliteDatabase) CredentialsByLogin(ctx context.Context, login string) (*Credentials, error) {
+	const query = `
+	SELECT
+		creds_id,
+		creds_tenant,
+		creds_login,
+		creds_passhash,
+		creds_must_change
+	FROM
+		goard_creds
+	WHERE
+		creds_tenant = ?
+	AND
+		creds_login = ?;`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	creds := &Credentials{}
+	if err = tx.QueryRowContext(ctx, query, TenantFromContext(ctx), login).Scan(
+		&creds.id,
+		&creds.tenant,
+		&creds.login,
+		&creds.passhash,
+		&creds.mustChange,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCredentialsNotFound
+		}
+		return nil, err
+	}
+
+	if creds.roles, creds.until, err = s.rolesByCredentialsID(ctx, tx, creds.id); err != nil {
+		return nil, err
+	}
+
+	if creds.permissions, err = s.permissionsByCredentialsID(ctx, tx, creds.id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// DeleteCredentials implements Database.
+func (s *sqliteDatabase) DeleteCredentials(ctx context.Context, credsID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_permissions WHERE creds_id = ?;`,
+		credsID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_creds_permissions WHERE creds_id = ?;`,
+		credsID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_creds WHERE creds_id = ?;`,
+		credsID,
+	); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateCredentials implements Database.
+func (s *sqliteDatabase) UpdateCredentials(ctx context.Context, credentials *Credentials) error {
+	const query = `
+	UPDATE
+		goard_creds
+	SET
+		creds_login = ?,
+		creds_passhash = ?,
+		updated_at = ?
+	WHERE
+		creds_id = ?
+	;`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query,
+		credentials.login,
+		credentials.passhash,
+		time.Now().UTC(),
+		credentials.id,
+	); err != nil {
+		return err
+	}
+
+	prev, _, err := s.rolesByCredentialsID(ctx, tx, credentials.id)
+	if err != nil {
+		return err
+	}
+
+	toDelete, toAdd := diffSlices(prev, credentials.roles)
+
+	for i := range toDelete {
+		if err = s.deletePermission(ctx, tx, credentials.id, toDelete[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := range toAdd {
+		roleID, err := s.createRoleIfNotExists(ctx, tx, toAdd[i])
+		if err != nil {
+			return err
+		}
+		if err = s.createPermission(ctx, tx, credentials.id, roleID, false); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddRole implements Database.
+func (s *sqliteDatabase) AddRole(ctx context.Context, credsID int64, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	roleID, err := s.createRoleIfNotExists(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	if err = s.createPermission(ctx, tx, credsID, roleID, true); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddRoleUntil implements Database. An existing grant of the role is replaced.
+func (s *sqliteDatabase) AddRoleUntil(ctx context.Context, credsID int64, role string, until time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	roleID, err := s.createRoleIfNotExists(ctx, tx, role)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM goard_permissions WHERE creds_id = ? AND role_id = ?;`,
+		credsID, roleID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO goard_permissions (creds_id, role_id, created_at, expires_at) VALUES (?, ?, ?, ?);`,
+		credsID, roleID, time.Now().UTC(), until.UTC(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpiredPermissions implements Database.
+func (s *sqliteDatabase) DeleteExpiredPermissions(ctx context.Context) (int64, error) {
+	// DELETE ... LIMIT needs a build option most SQLite drivers lack
+	return deleteInBatches(ctx, s.db, s.options,
+		`DELETE FROM goard_permissions WHERE rowid IN (
+			SELECT rowid FROM goard_permissions WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?
+		);`,
+		time.Now().UTC(),
+	)
+}
+
+// RemoveRole implements Database.
+func (s *sqliteDatabase) RemoveRole(ctx context.Context, credsID int64, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = s.deletePermission(ctx, tx, credsID, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountRole implements Database.
+func (s *sqliteDatabase) CountRole(ctx context.Context, role string) (int, error) {
+	const query = `
+	SELECT
+		COUNT(DISTINCT goard_permissions.creds_id)
+	FROM
+		goard_permissions
+	JOIN
+		goard_roles
+	ON
+		goard_permissions.role_id = goard_roles.role_id
+	WHERE
+		goard_roles.role_name = ?
+	AND
+		(goard_permissions.expires_at IS NULL OR goard_permissions.expires_at > ?);`
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, role, time.Now().UTC()).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RenameRole implements Database.
+func (s *sqliteDatabase) RenameRole(ctx context.Context, from, to string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ok int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT 1 FROM goard_roles WHERE role_name = ?;`,
+		to,
+	).Scan(&ok); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	} else {
+		return ErrRoleConflict
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE goard_roles SET role_name = ? WHERE role_name = ?;`,
+		to, from,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRole implements Database.
+func (s *sqliteDatabase) DeleteRole(ctx context.Context, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const query = `
+	DELETE FROM
+	    goard_permissions
+	WHERE
+	    role_id IN (SELECT role_id FROM goard_roles WHERE role_name = ?);`
+
+	if _, err = tx.ExecContext(ctx, query, role); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM goard_roles WHERE role_name = ?;`,
+		role,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+// ListRoles implements Database.
+func (s *sqliteDatabase) ListRoles(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT role_name FROM goard_roles ORDER BY role_name;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// ForEachCredentials implements Database. Roles are not loaded.
+func (s *sqliteDatabase) ForEachCredentials(ctx context.Context, callback func(*Credentials) error) error {
+	const query = `
+	SELECT
+		creds_id,
+		creds_tenant,
+		creds_login,
+		creds_passhash,
+		creds_must_change
+	FROM
+		goard_creds
+	ORDER BY
+		creds_id;`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Buffer rows so callbacks may use the database without holding this query open
+	all := []*Credentials{}
+
+	for rows.Next() {
+		creds := &Credentials{}
+		if err = rows.Scan(
+			&creds.id,
+			&creds.tenant,
+			&creds.login,
+			&creds.passhash,
+			&creds.mustChange,
+		); err != nil {
+			return err
+		}
+		all = append(all, creds)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range all {
+		if err = callback(all[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdatePasshash implements Database.
+func (s *sqliteDatabase) UpdatePasshash(ctx context.Context, credsID int64, passhash string) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE goard_creds SET creds_passhash = ?, updated_at = ? WHERE creds_id = ?;`,
+		passhash, time.Now().UTC(), credsID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrCredentialsNotFound
+	}
+
+	return nil
+}
+
+// SetMustChangePassword implements Database.
+func (s *sqliteDatabase) SetMustChangePassword(ctx context.Context, credsID int64, must bool) error {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE goard_creds SET creds_must_change = ?, updated_at = ? WHERE creds_id = ?;`,
+		must, time.Now().UTC(), credsID,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewSQLiteDatabase works with any database/sql SQLite driver, the caller
+// imports one (e.g. mattn/go-sqlite3 or modernc.org/sqlite) and opens db
+func NewSQLiteDatabase(db *sql.DB) Database {
+	return NewSQLiteDatabaseWithOptions(db, DatabaseOptions{})
+}
+
+func NewSQLiteDatabaseWithOptions(db *sql.DB, options DatabaseOptions) Database {
+	return &sqliteDatabase{
+		db:      db,
+		options: options.withDefaults(),
+	}
+}
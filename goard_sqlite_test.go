@@ -0,0 +1,254 @@
+package goard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDatabaseCredentials(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	if err := db.CreateCredentials(ctx, &Credentials{
+		id:       1,
+		login:    "alice",
+		passhash: "hash-1",
+		roles:    []string{"editor", "viewer"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	byID, err := db.CredentialsByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.login != "alice" || byID.passhash != "hash-1" {
+		t.Fatalf("CredentialsByID = %q %q, want alice hash-1", byID.login, byID.passhash)
+	}
+	if !slices.Equal(byID.roles, []string{"editor", "viewer"}) {
+		t.Fatalf("roles = %v, want [editor viewer]", byID.roles)
+	}
+
+	byLogin, err := db.CredentialsByLogin(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byLogin.id != 1 {
+		t.Fatalf("CredentialsByLogin id = %d, want 1", byLogin.id)
+	}
+
+	// Drop viewer, keep editor, add admin
+	updated := *byID
+	updated.login = "alice2"
+	updated.passhash = "hash-2"
+	updated.roles = []string{"admin", "editor"}
+	if err := db.UpdateCredentials(ctx, &updated); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.CredentialsByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.login != "alice2" || got.passhash != "hash-2" {
+		t.Fatalf("after update = %q %q, want alice2 hash-2", got.login, got.passhash)
+	}
+	if !slices.Equal(got.roles, []string{"admin", "editor"}) {
+		t.Fatalf("roles after update = %v, want [admin editor]", got.roles)
+	}
+	if n, err := db.CountRole(ctx, "viewer"); err != nil || n != 0 {
+		t.Fatalf("CountRole(viewer) = %d, %v, want 0", n, err)
+	}
+
+	if err := db.DeleteCredentials(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CredentialsByID(ctx, 1); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("CredentialsByID after delete = %v, want ErrCredentialsNotFound", err)
+	}
+	if _, err := db.CredentialsByLogin(ctx, "alice2"); !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("CredentialsByLogin after delete = %v, want ErrCredentialsNotFound", err)
+	}
+}
+
+func TestSQLiteDatabaseRolesKeepOtherAccounts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	for id, login := range map[int64]string{1: "alice", 2: "bob"} {
+		if err := db.CreateCredentials(ctx, &Credentials{
+			id:       id,
+			login:    login,
+			passhash: "hash",
+			roles:    []string{"editor"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.UpdateCredentials(ctx, &Credentials{id: 1, login: "alice", passhash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := db.CredentialsByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.roles) != 0 {
+		t.Fatalf("alice roles = %v, want none", alice.roles)
+	}
+
+	bob, err := db.CredentialsByID(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(bob.roles, []string{"editor"}) {
+		t.Fatalf("bob roles = %v, want [editor]", bob.roles)
+	}
+}
+
+func TestSQLiteDeleteExpiredPermissionsInBatches(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	defer conn.Close()
+
+	db := NewSQLiteDatabaseWithOptions(conn, DatabaseOptions{DeleteBatch: 100})
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 450 lapsed grants spread over several batches, and one still running
+	past := time.Now().Add(-time.Hour)
+	for id := int64(1); id <= 45; id++ {
+		if err := db.CreateCredentials(ctx, &Credentials{id: id, login: "user" + strconv.FormatInt(id, 10), passhash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+		for role := range 10 {
+			if err := db.AddRoleUntil(ctx, id, "role"+strconv.Itoa(role), past); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.AddRoleUntil(ctx, 1, "contractor", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.DeleteExpiredPermissions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 450 {
+		t.Fatalf("DeleteExpiredPermissions = %d, want 450", n)
+	}
+
+	var left int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM goard_permissions;`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 1 {
+		t.Fatalf("%d permission rows left, want the running grant only", left)
+	}
+}
+
+func TestSQLiteDatabasePermissions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	for id, login := range []string{"alice", "bob"} {
+		if err := db.CreateCredentials(ctx, &Credentials{id: int64(id + 1), login: login, passhash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	permissions := db.(PermissionDatabase)
+	for _, permission := range []string{"posts:write", "posts:read", "posts:write"} {
+		if err := permissions.AddPermission(ctx, 1, permission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := permissions.AddPermission(ctx, 2, "posts:read"); err != nil {
+		t.Fatal(err)
+	}
+
+	granted := func(id int64) []string {
+		t.Helper()
+		creds, err := db.CredentialsByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds.Permissions()
+	}
+	if got := granted(1); !slices.Equal(got, []string{"posts:read", "posts:write"}) {
+		t.Fatalf("permissions = %v, want [posts:read posts:write]", got)
+	}
+
+	if err := permissions.RemovePermission(ctx, 1, "posts:read"); err != nil {
+		t.Fatal(err)
+	}
+	if got := granted(1); !slices.Equal(got, []string{"posts:write"}) {
+		t.Fatalf("permissions after revoking = %v, want [posts:write]", got)
+	}
+	if got := granted(2); !slices.Equal(got, []string{"posts:read"}) {
+		t.Fatalf("other account permissions = %v, want [posts:read]", got)
+	}
+}
+
+func TestSQLiteUpdateCredentialsKeepsGrantExpiry(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+	if err := db.CreateCredentials(ctx, &Credentials{id: 1, login: "alice", passhash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() *Credentials {
+		t.Helper()
+		creds, err := db.CredentialsByID(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds
+	}
+
+	// A stale role list naming a time-boxed grant keeps its expiry
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := db.AddRoleUntil(ctx, 1, "editor", until); err != nil {
+		t.Fatal(err)
+	}
+	stale := load()
+	if err := db.UpdateCredentials(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	if exp, ok := load().RoleExpiresAt("editor"); !ok || !exp.Equal(until) {
+		t.Fatalf("editor expires at %v (%v), want %v", exp, ok, until)
+	}
+
+	// Nor does it revive a grant lapsed since it was loaded
+	if err := db.AddRoleUntil(ctx, 1, "editor", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateCredentials(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	if roles := load().Roles(); len(roles) != 0 {
+		t.Fatalf("roles = %v, lapsed grant revived", roles)
+	}
+
+	// AddRole makes a grant permanent
+	if err := db.AddRoleUntil(ctx, 1, "editor", until); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddRole(ctx, 1, "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if exp, ok := load().RoleExpiresAt("editor"); ok {
+		t.Fatalf("editor expires at %v after AddRole, want permanent", exp)
+	}
+}
@@ -3,17 +3,105 @@ package goard
 import (
 	"context"
 	"sync"
+	"time"
 )
 
+// SessionEventType is the kind of a session lifecycle event
+type SessionEventType int
+
+const (
+	EventCreated SessionEventType = iota
+	EventUpdated
+	EventRevoked
+	EventExpired
+)
+
+type SessionEvent struct {
+	Type    SessionEventType
+	Session *Session
+	At      time.Time
+}
+
+// eventBuffer is how many events a slow subscriber may lag behind before new ones are dropped
+const eventBuffer = 64
+
 type store struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
+
+	smu         sync.Mutex
+	subscribers map[int]chan SessionEvent
+	next        int
+}
+
+func (s *store) emit(kind SessionEventType, session *Session) {
+	s.smu.Lock()
+	defer s.smu.Unlock()
+	event := SessionEvent{Type: kind, Session: session, At: time.Now()}
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe calls callback for every session lifecycle event until the returned
+// function is called. Delivery never blocks the store: events are dropped
+// while the subscriber lags more than a small buffer behind.
+func (s *store) Subscribe(callback func(SessionEvent)) (unsubscribe func()) {
+	ch := make(chan SessionEvent, eventBuffer)
+
+	s.smu.Lock()
+	id := s.next
+	s.next++
+	s.subscribers[id] = ch
+	s.smu.Unlock()
+
+	go func() {
+		for event := range ch {
+			callback(event)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.smu.Lock()
+			delete(s.subscribers, id)
+			s.smu.Unlock()
+			close(ch)
+		})
+	}
 }
 
 func (s *store) CreateSession(_ context.Context, session *Session) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	_, exists := s.sessions[session.ID()]
 	s.sessions[session.ID()] = session
+	s.mu.Unlock()
+
+	if exists {
+		s.emit(EventUpdated, session)
+	} else {
+		s.emit(EventCreated, session)
+	}
+	return nil
+}
+
+// UpdateSession implements UpdatingStore.
+func (s *store) UpdateSession(_ context.Context, session *Session) error {
+	s.mu.Lock()
+	_, exists := s.sessions[session.ID()]
+	if exists {
+		s.sessions[session.ID()] = session
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		return ErrSessionNotFound
+	}
+	s.emit(EventUpdated, session)
 	return nil
 }
 
@@ -28,8 +116,19 @@ func (s *store) InvokeSession(_ context.Context, id string) (*Session, error) {
 
 func (s *store) RevokeSession(_ context.Context, id string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
 	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if time.Now().Before(session.exp) {
+		s.emit(EventRevoked, session)
+	} else {
+		s.emit(EventExpired, session)
+	}
 	return nil
 }
 
@@ -39,10 +138,21 @@ func (s *store) Count(_ context.Context) int {
 	return len(s.sessions)
 }
 
+// Reset revokes every session, emitting their events like RevokeSession
 func (s *store) Reset(_ context.Context) error {
 	s.mu.Lock()
-	defer s.mu.RUnlock()
+	sessions := s.sessions
 	s.sessions = make(map[string]*Session)
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range sessions {
+		if now.Before(session.exp) {
+			s.emit(EventRevoked, session)
+		} else {
+			s.emit(EventExpired, session)
+		}
+	}
 	return nil
 }
 
@@ -63,6 +173,7 @@ func (s *store) ForEach(ctx context.Context, callback func(session *Session) err
 
 func NewStore() *store {
 	return &store{
-		sessions: make(map[string]*Session),
+		sessions:    make(map[string]*Session),
+		subscribers: make(map[int]chan SessionEvent),
 	}
 }
@@ -0,0 +1,226 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreResetConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				id := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				if err := s.CreateSession(ctx, &Session{id: id, exp: time.Now().Add(time.Hour)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				_ = s.Count(ctx)
+				_ = s.ForEach(ctx, func(*Session) error { return nil })
+				_, _ = s.InvokeSession(ctx, strconv.Itoa(i)+"-0")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if err := s.Reset(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Count(ctx); n != 0 {
+		t.Fatalf("Count after Reset = %d, want 0", n)
+	}
+}
+
+func TestStoreResetEmitsRevoked(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+
+	events := make(chan SessionEvent, 8)
+	unsubscribe := s.Subscribe(func(e SessionEvent) { events <- e })
+	defer unsubscribe()
+
+	if err := s.CreateSession(ctx, &Session{id: "a", exp: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []SessionEventType{EventCreated, EventRevoked} {
+		select {
+		case e := <-events:
+			if e.Type != want || e.Session.ID() != "a" {
+				t.Fatalf("event = %v for %q, want %v for \"a\"", e.Type, e.Session.ID(), want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event %v", want)
+		}
+	}
+}
+
+func TestStoreEvents(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore()
+
+	events := make(chan SessionEvent, 8)
+	unsubscribe := s.Subscribe(func(e SessionEvent) { events <- e })
+
+	live := &Session{id: "live", exp: time.Now().Add(time.Hour)}
+	stale := &Session{id: "stale", exp: time.Now().Add(-time.Minute)}
+	for _, session := range []*Session{live, stale} {
+		if err := s.CreateSession(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"live", "stale"} {
+		if err := s.RevokeSession(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []struct {
+		kind SessionEventType
+		id   string
+	}{
+		{EventCreated, "live"},
+		{EventCreated, "stale"},
+		{EventRevoked, "live"},
+		{EventExpired, "stale"},
+	} {
+		select {
+		case e := <-events:
+			if e.Type != want.kind || e.Session.ID() != want.id {
+				t.Fatalf("event = %v for %q, want %v for %q", e.Type, e.Session.ID(), want.kind, want.id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event %v for %q", want.kind, want.id)
+		}
+	}
+
+	unsubscribe()
+	if err := s.CreateSession(ctx, &Session{id: "late", exp: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("event %v for %q after unsubscribe", e.Type, e.Session.ID())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTieredStore(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewStore(), &countingStore{store: NewStore()}
+	tiered := NewTieredStore(l1, l2)
+	session := func(id string) *Session {
+		return &Session{id: id, exp: time.Now().Add(time.Hour)}
+	}
+
+	// Written through, read from l1
+	if err := tiered.CreateSession(ctx, session("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tiered.InvokeSession(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := l2.invoked.Load(); n != 0 {
+		t.Fatalf("l1 hit reached l2 %d times", n)
+	}
+
+	// Created by another instance, missed and populated
+	if err := l2.CreateSession(ctx, session("b")); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := tiered.InvokeSession(ctx, "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := l2.invoked.Load(); n != 1 {
+		t.Fatalf("l2 looked up %d times, want 1", n)
+	}
+	if _, err := l1.InvokeSession(ctx, "b"); err != nil {
+		t.Fatalf("l1 not populated: %v", err)
+	}
+
+	// Revoked through the tiered store, gone from both
+	if err := tiered.RevokeSession(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l1.InvokeSession(ctx, "a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("l1 after revoke: %v", err)
+	}
+	if _, err := tiered.InvokeSession(ctx, "a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("InvokeSession after revoke = %v, want ErrSessionNotFound", err)
+	}
+
+	// Revoked by another instance, dropped from l1 once its copy is stale
+	if err := l2.RevokeSession(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	tiered.(*tieredStore).ttl = 0
+	if _, err := tiered.InvokeSession(ctx, "b"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("InvokeSession of a stale copy = %v, want ErrSessionNotFound", err)
+	}
+	if n := l1.Count(ctx); n != 0 {
+		t.Fatalf("l1 keeps %d sessions", n)
+	}
+	if n := tiered.Count(ctx); n != 0 {
+		t.Fatalf("Count = %d, want 0", n)
+	}
+}
+
+func TestTieredStorePrunesStaleCopies(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewStore(), NewStore()
+	tiered := NewTieredStoreWithOptions(l1, l2, TieredOptions{L1TTL: 20 * time.Millisecond})
+	session := func(id string) *Session {
+		return &Session{id: id, exp: time.Now().Add(time.Hour)}
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if err := tiered.CreateSession(ctx, session(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Revoked by another instance and never read here again
+	if err := l2.RevokeSession(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := tiered.CreateSession(ctx, session("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := l1.Count(ctx); n != 1 {
+		t.Fatalf("l1 keeps %d sessions, want 1", n)
+	}
+	if _, err := l1.InvokeSession(ctx, "c"); err != nil {
+		t.Fatalf("l1 lost the fresh copy: %v", err)
+	}
+	if n := len(tiered.(*tieredStore).cached); n != 1 {
+		t.Fatalf("tiered store tracks %d copies, want 1", n)
+	}
+}
@@ -0,0 +1,101 @@
+package goard
+
+import (
+	"context"
+	"sync"
+)
+
+// swapStore is the Store Goard works with, delegating to the one SetStore
+// installed last
+type swapStore struct {
+	mu    sync.RWMutex
+	store Store
+}
+
+func (s *swapStore) current() Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
+}
+
+func (s *swapStore) CreateSession(ctx context.Context, session *Session) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store.CreateSession(ctx, session)
+}
+
+// UpdateSession implements UpdatingStore, falling back to a lookup followed
+// by CreateSession for stores without UpdateSession. The fallback narrows the
+// race with revocations without closing it.
+func (s *swapStore) UpdateSession(ctx context.Context, session *Session) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if updating, ok := s.store.(UpdatingStore); ok {
+		return updating.UpdateSession(ctx, session)
+	}
+
+	if _, err := s.store.InvokeSession(ctx, session.id); err != nil {
+		return err
+	}
+	return s.store.CreateSession(ctx, session)
+}
+
+func (s *swapStore) InvokeSession(ctx context.Context, id string) (*Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store.InvokeSession(ctx, id)
+}
+
+func (s *swapStore) RevokeSession(ctx context.Context, id string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store.RevokeSession(ctx, id)
+}
+
+// ForEach doesn't hold the lock while iterating, callbacks call back into the store
+func (s *swapStore) ForEach(ctx context.Context, callback func(*Session) error) error {
+	return s.current().ForEach(ctx, callback)
+}
+
+func (s *swapStore) Reset(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store.Reset(ctx)
+}
+
+func (s *swapStore) Count(ctx context.Context) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store.Count(ctx)
+}
+
+// swap installs store, first copying the sessions of the old one when migrate
+// is set. Store calls wait until it is done.
+func (s *swapStore) swap(ctx context.Context, store Store, migrate bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if migrate {
+		if err := s.store.ForEach(ctx, func(session *Session) error {
+			return store.CreateSession(ctx, session)
+		}); err != nil {
+			return err
+		}
+	}
+
+	s.store = store
+	return nil
+}
+
+// SetStore replaces the session store at runtime, e.g. to move from memory to
+// a shared store without downtime. With migrate, live sessions are copied to
+// store first and the old store is left as it was, otherwise they are lost.
+//
+// Session lookups and writes wait while the swap runs, so a large migration
+// stalls requests. Iterations already running (cleanup sweeps, revocations)
+// finish on the old store and their changes are not carried over, and
+// subscriptions to the old store's events are not moved.
+func (g *Goard) SetStore(ctx context.Context, store Store, migrate bool) error {
+	return g.store.swap(ctx, store, migrate)
+}
@@ -0,0 +1,67 @@
+package goard
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestSetStore(t *testing.T) {
+	ctx := context.Background()
+	g := newTestGoard(t, &Config{})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+	signUpAccount(t, g, "bob", "Secret-pass-1")
+	alice := signInCookie(t, g, "alice", "Secret-pass-1")
+	bob := signInCookie(t, g, "bob", "Secret-pass-1")
+	h := g.Guard(okHandler, func(*Session) bool { return true })
+
+	// Requests in flight during the swap see one store or the other, both
+	// holding the sessions
+	var wg sync.WaitGroup
+	codes := make(chan int, 200)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				codes <- serve(h, http.MethodGet, alice).Code
+			}
+		}()
+	}
+
+	migrated := NewStore()
+	if err := g.SetStore(ctx, migrated, true); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("Guard during the swap = %d, want 200", code)
+		}
+	}
+
+	if n := migrated.Count(ctx); n != 2 {
+		t.Fatalf("migrated store holds %d sessions, want 2", n)
+	}
+	for _, cookie := range []*http.Cookie{alice, bob} {
+		if rec := serve(h, http.MethodGet, cookie); rec.Code != http.StatusOK {
+			t.Fatalf("Guard after migrating = %d, want 200", rec.Code)
+		}
+	}
+
+	// New sessions land in the new store
+	signInCookie(t, g, "alice", "Secret-pass-1")
+	if n := migrated.Count(ctx); n != 3 {
+		t.Fatalf("store holds %d sessions after a sign in, want 3", n)
+	}
+
+	// Without migrating, sessions stay behind
+	if err := g.SetStore(ctx, NewStore(), false); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(h, http.MethodGet, bob); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Guard after an unmigrated swap = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package goard
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TenantFromHeader resolves the tenant from a request header, e.g. X-Tenant
+func TenantFromHeader(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// TenantFromSubdomain resolves the tenant from the leftmost label of the
+// TLS server name (SNI), falling back to the Host header
+func TenantFromSubdomain() func(*http.Request) string {
+	return func(r *http.Request) string {
+		host := r.Host
+		if r.TLS != nil && r.TLS.ServerName != "" {
+			host = r.TLS.ServerName
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		label, _, ok := strings.Cut(host, ".")
+		if !ok {
+			return ""
+		}
+		return label
+	}
+}
@@ -0,0 +1,103 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSameLoginAcrossTenants(t *testing.T) {
+	g := newTestGoard(t, &Config{TenantResolver: TenantFromHeader("X-Tenant")})
+
+	accounts := map[string]int64{}
+	for tenant, password := range map[string]string{"acme": "Acme-pass-1", "globex": "Globex-pass-1"} {
+		account, err := g.signup(WithTenant(context.Background(), tenant), json.RawMessage(`{}`), "alice", password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts[tenant] = account.GetID()
+	}
+
+	signIn := func(tenant, password string) *httptest.ResponseRecorder {
+		r := request(http.MethodPost, `{"login":"alice","password":"`+password+`"}`)
+		r.Header.Set("X-Tenant", tenant)
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, r)
+		return rec
+	}
+
+	for tenant, password := range map[string]string{"acme": "Acme-pass-1", "globex": "Globex-pass-1"} {
+		rec := signIn(tenant, password)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: SignIn = %d, want 200", tenant, rec.Code)
+		}
+
+		session, err := g.Authorize(context.Background(), cookieSession(g, sessionCookie(t, rec)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Account().GetID() != accounts[tenant] || session.Shard() != tenant {
+			t.Fatalf("%s: session of account %d on %q, want %d", tenant, session.Account().GetID(), session.Shard(), accounts[tenant])
+		}
+	}
+
+	if rec := signIn("acme", "Globex-pass-1"); rec.Code != http.StatusForbidden {
+		t.Fatalf("other tenant's password: SignIn = %d, want 403", rec.Code)
+	}
+	if rec := signIn("", "Acme-pass-1"); rec.Code != http.StatusForbidden {
+		t.Fatalf("no tenant: SignIn = %d, want 403", rec.Code)
+	}
+}
+
+// lookupDatabase counts credentials lookups by ID reaching one shard
+type lookupDatabase struct {
+	Database
+	lookups atomic.Int32
+}
+
+func (d *lookupDatabase) CredentialsByID(ctx context.Context, id int64) (*Credentials, error) {
+	d.lookups.Add(1)
+	return d.Database.CredentialsByID(ctx, id)
+}
+
+func TestSessionShardRoutesLookups(t *testing.T) {
+	ctx := context.Background()
+	acme := &lookupDatabase{Database: newTestDatabase(t)}
+	globex := &lookupDatabase{Database: newTestDatabase(t)}
+	g := newTestGoard(t, &Config{Database: NewShardedDatabase(map[string]Database{"acme": acme, "globex": globex}, nil)})
+
+	tenant := WithTenant(ctx, "globex")
+	account, err := g.signup(tenant, json.RawMessage(`{}`), "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := g.AuthenticatePassword(tenant, "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Shard() != "globex" {
+		t.Fatalf("Shard = %q, want globex", session.Shard())
+	}
+
+	if err := globex.AddRole(ctx, account.GetID(), "editor"); err != nil {
+		t.Fatal(err)
+	}
+	acme.lookups.Store(0)
+	globex.lookups.Store(0)
+
+	// The request context carries no tenant, the session does
+	refreshed, err := g.refreshRoles(ctx, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(refreshed.Roles(), "editor") {
+		t.Fatalf("roles = %v, want the globex grant", refreshed.Roles())
+	}
+	if acme.lookups.Load() != 0 || globex.lookups.Load() == 0 {
+		t.Fatalf("lookups acme %d, globex %d, want globex only", acme.lookups.Load(), globex.lookups.Load())
+	}
+}
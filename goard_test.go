@@ -0,0 +1,234 @@
+package goard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// testHasher is shared so its warning is logged once
+var testHasher = NewFastTestHasher(true)
+
+// testApp keeps accounts in memory
+type testApp struct {
+	mu       sync.Mutex
+	next     int64
+	accounts map[int64]json.RawMessage
+}
+
+func (a *testApp) CreateAccount(_ context.Context, account json.RawMessage) (Account, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.next++
+	if a.accounts == nil {
+		a.accounts = make(map[int64]json.RawMessage)
+	}
+	a.accounts[a.next] = account
+	return BaseAccount{ID: a.next}, nil
+}
+
+func (a *testApp) AccountByID(_ context.Context, id int64) (Account, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.accounts[id]; !ok {
+		return nil, ErrCredentialsNotFound
+	}
+	return BaseAccount{ID: id}, nil
+}
+
+func (a *testApp) DeleteAccount(_ context.Context, id int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.accounts, id)
+	return nil
+}
+
+// newTestDatabase returns a migrated SQLite database living in memory
+func newTestDatabase(t *testing.T) Database {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	database := NewSQLiteDatabase(db)
+	if err := database.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// newTestGoard fills the config with an in-memory app and database, a cookie
+// container and the fast test hasher
+func newTestGoard(t *testing.T, config *Config) *Goard {
+	t.Helper()
+
+	if config.App == nil {
+		config.App = &testApp{}
+	}
+	if config.Database == nil {
+		config.Database = newTestDatabase(t)
+	}
+	if config.Container == nil {
+		config.Container = NewCookiesContainer("sid")
+	}
+	if config.Hasher == nil {
+		config.Hasher = testHasher
+	}
+	if config.Admin.Login == "" {
+		config.Admin = Admin{Account: BaseAccount{}, Login: "root", Password: "Root-pass-1"}
+	}
+
+	g := New(config)
+	if g == nil {
+		t.Fatal("New returned nil")
+	}
+	return g
+}
+
+// signUpAccount creates credentials through the sign up path
+func signUpAccount(t *testing.T, g *Goard, login, password string) int64 {
+	t.Helper()
+
+	account, err := g.signup(context.Background(), json.RawMessage(`{}`), login, password)
+	if err != nil {
+		t.Fatalf("signup %s: %v", login, err)
+	}
+	return account.GetID()
+}
+
+// signInCookie signs in through the handler and returns the session cookie
+func signInCookie(t *testing.T, g *Goard, login, password string) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	g.SignIn(rec, httptest.NewRequest(http.MethodPost, "/signin",
+		strings.NewReader(`{"login":"`+login+`","password":"`+password+`"}`),
+	))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SignIn = %d, want 200", rec.Code)
+	}
+	return sessionCookie(t, rec)
+}
+
+// sessionCookie returns the session cookie a response set
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "sid" {
+			return cookie
+		}
+	}
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+// cookieSession reads the session ID a cookie carries
+func cookieSession(g *Goard, cookie *http.Cookie) string {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	return g.container.GetSession(r)
+}
+
+// serve sends a request carrying cookie, if any, to h
+func serve(h http.Handler, method string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// logRecord is a message passed to recordLogger
+type logRecord struct {
+	level string
+	msg   string
+	args  []any
+}
+
+// recordLogger keeps every message it is given
+type recordLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordLogger) log(level, msg string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, args: args})
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.log("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.log("info", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.log("warn", msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.log("error", msg, args) }
+
+// logged returns the records of a level whose message contains substr
+func (l *recordLogger) logged(level, substr string) []logRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logRecord
+	for _, r := range l.records {
+		if r.level == level && strings.Contains(r.msg, substr) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestStatusForError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusOK},
+		{ErrMethod, http.StatusMethodNotAllowed},
+		{&MethodError{Allow: http.MethodPost}, http.StatusMethodNotAllowed},
+		{ErrBodyTimeout, http.StatusRequestTimeout},
+		{ErrBadCredentials, http.StatusBadRequest},
+		{&ValidationError{Rules: []ValidationRule{RuleTooShort}}, http.StatusBadRequest},
+		{ErrAccountLocked, http.StatusTooManyRequests},
+		{ErrSessionNotFound, http.StatusUnauthorized},
+		{ErrSessionExpired, http.StatusUnauthorized},
+		{ErrSessionRevoked, http.StatusUnauthorized},
+		{ErrBadSessionID, http.StatusUnauthorized},
+		{ErrBadToken, http.StatusUnauthorized},
+		{ErrAccessDenied, http.StatusForbidden},
+		{ErrScopeDenied, http.StatusForbidden},
+		{ErrCredentialsNotFound, http.StatusForbidden},
+		{ErrCredentialsMismatch, http.StatusForbidden},
+		{ErrBadUnlockToken, http.StatusForbidden},
+		{ErrRoleNotFound, http.StatusNotFound},
+		{ErrUnknownTenant, http.StatusNotFound},
+		{ErrCredentialsConflict, http.StatusConflict},
+		{ErrRoleConflict, http.StatusConflict},
+		{ErrLastAdmin, http.StatusConflict},
+		{ErrTooManyRoles, http.StatusUnprocessableEntity},
+		{ErrNoPermissions, http.StatusNotImplemented},
+		{ErrCookieConfig, http.StatusInternalServerError},
+		{ErrJWTConfig, http.StatusInternalServerError},
+		{ErrUnsafeHasher, http.StatusInternalServerError},
+		{errors.New("database unavailable"), http.StatusInternalServerError},
+		{fmt.Errorf("granting role: %w", ErrLastAdmin), http.StatusConflict},
+	} {
+		if got := StatusForError(tc.err); got != tc.want {
+			t.Errorf("StatusForError(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
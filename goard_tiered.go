@@ -0,0 +1,192 @@
+package goard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DEFAULT_L1_TTL bounds how long the tiered store trusts its L1 copy of a session
+const DEFAULT_L1_TTL = 5 * time.Second
+
+// TieredOptions tune the tiered store
+type TieredOptions struct {
+	// L1TTL - is how long an l1 copy is trusted before l2 is asked again, DEFAULT_L1_TTL by default
+	L1TTL time.Duration
+}
+
+type tieredStore struct {
+	l1, l2 Store
+	ttl    time.Duration
+
+	mu     sync.Mutex
+	cached map[string]time.Time
+	pruned time.Time
+}
+
+func (t *tieredStore) fresh(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.cached[id]
+	return ok && time.Since(at) < t.ttl
+}
+
+func (t *tieredStore) remember(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cached[id] = time.Now()
+}
+
+func (t *tieredStore) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.cached, id)
+}
+
+// prune drops l1 copies older than ttl, at most once per ttl, so sessions
+// revoked by other instances or never read again don't pile up in l1
+func (t *tieredStore) prune(ctx context.Context) error {
+	now := time.Now()
+	var stale []string
+
+	t.mu.Lock()
+	if now.Sub(t.pruned) < t.ttl {
+		t.mu.Unlock()
+		return nil
+	}
+	t.pruned = now
+	for id, at := range t.cached {
+		if now.Sub(at) >= t.ttl {
+			stale = append(stale, id)
+			delete(t.cached, id)
+		}
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, id := range stale {
+		errs = append(errs, t.l1.RevokeSession(ctx, id))
+	}
+	return errors.Join(errs...)
+}
+
+// CreateSession implements Store.
+func (t *tieredStore) CreateSession(ctx context.Context, session *Session) error {
+	if err := t.prune(ctx); err != nil {
+		return err
+	}
+	if err := t.l2.CreateSession(ctx, session); err != nil {
+		return err
+	}
+	if err := t.l1.CreateSession(ctx, session); err != nil {
+		return err
+	}
+	t.remember(session.id)
+	return nil
+}
+
+// UpdateSession implements UpdatingStore, l2 decides whether the session still exists
+func (t *tieredStore) UpdateSession(ctx context.Context, session *Session) error {
+	if updating, ok := t.l2.(UpdatingStore); ok {
+		if err := updating.UpdateSession(ctx, session); err != nil {
+			return err
+		}
+	} else {
+		if _, err := t.l2.InvokeSession(ctx, session.id); err != nil {
+			return err
+		}
+		if err := t.l2.CreateSession(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	if err := t.l1.CreateSession(ctx, session); err != nil {
+		return err
+	}
+	t.remember(session.id)
+	return nil
+}
+
+// InvokeSession implements Store.
+func (t *tieredStore) InvokeSession(ctx context.Context, id string) (*Session, error) {
+	if err := t.prune(ctx); err != nil {
+		return nil, err
+	}
+
+	if t.fresh(id) {
+		if session, err := t.l1.InvokeSession(ctx, id); err == nil {
+			return session, nil
+		}
+	}
+
+	session, err := t.l2.InvokeSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			t.forget(id)
+			if err := t.l1.RevokeSession(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := t.l1.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	t.remember(id)
+
+	return session, nil
+}
+
+// RevokeSession implements Store.
+func (t *tieredStore) RevokeSession(ctx context.Context, id string) error {
+	t.forget(id)
+	if err := t.l1.RevokeSession(ctx, id); err != nil {
+		return err
+	}
+	return t.l2.RevokeSession(ctx, id)
+}
+
+// ForEach implements Store.
+func (t *tieredStore) ForEach(ctx context.Context, callback func(s *Session) error) error {
+	return t.l2.ForEach(ctx, callback)
+}
+
+// Reset implements Store.
+func (t *tieredStore) Reset(ctx context.Context) error {
+	t.mu.Lock()
+	t.cached = make(map[string]time.Time)
+	t.mu.Unlock()
+	if err := t.l1.Reset(ctx); err != nil {
+		return err
+	}
+	return t.l2.Reset(ctx)
+}
+
+// Count implements Store.
+func (t *tieredStore) Count(ctx context.Context) int {
+	return t.l2.Count(ctx)
+}
+
+// NewTieredStore fronts a shared l2 store with a per-instance l1 cache.
+// Reads hit l1 for up to DEFAULT_L1_TTL, writes and revokes go to both,
+// ForEach and Count are answered by l2. Copies older than that are dropped
+// from l1 as the store is used.
+func NewTieredStore(l1, l2 Store) Store {
+	return NewTieredStoreWithOptions(l1, l2, TieredOptions{})
+}
+
+// NewTieredStoreWithOptions is NewTieredStore trusting l1 for options.L1TTL
+func NewTieredStoreWithOptions(l1, l2 Store, options TieredOptions) Store {
+	if options.L1TTL <= 0 {
+		options.L1TTL = DEFAULT_L1_TTL
+	}
+
+	return &tieredStore{
+		l1:     l1,
+		l2:     l2,
+		ttl:    options.L1TTL,
+		cached: make(map[string]time.Time),
+	}
+}
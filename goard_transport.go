@@ -2,68 +2,412 @@ package goard
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 )
 
-type jsonTranport struct{}
+// Operation names a Transport request kind
+type Operation string
+
+const (
+	OpSignIn    Operation = "signin"
+	OpSignUp    Operation = "signup"
+	OpSetRole   Operation = "setrole"
+	OpUnsetRole Operation = "unsetrole"
+	OpOffboard  Operation = "offboard"
+	OpVerify    Operation = "verify"
+	OpCheck     Operation = "check"
+
+	OpSetPermission   Operation = "setpermission"
+	OpUnsetPermission Operation = "unsetpermission"
+	OpChangePassword  Operation = "changepassword"
+	OpRequestUnlock   Operation = "requestunlock"
+	OpUnlock          Operation = "unlock"
+)
+
+var defaultMethods = map[Operation]string{
+	OpSignIn:    http.MethodPost,
+	OpSignUp:    http.MethodPost,
+	OpSetRole:   http.MethodPatch,
+	OpUnsetRole: http.MethodPatch,
+	OpOffboard:  http.MethodDelete,
+	OpVerify:    http.MethodPost,
+	OpCheck:     http.MethodPost,
+
+	OpSetPermission:   http.MethodPatch,
+	OpUnsetPermission: http.MethodPatch,
+	OpChangePassword:  http.MethodPost,
+	OpRequestUnlock:   http.MethodPost,
+	OpUnlock:          http.MethodPost,
+}
+
+// MethodError is returned by transports for a request with an unexpected method
+type MethodError struct {
+	// Allow - is the method the operation accepts
+	Allow string
+}
+
+func (e *MethodError) Error() string {
+	return ErrMethod.Error()
+}
+
+func (e *MethodError) Is(target error) bool {
+	return target == ErrMethod
+}
+
+// deadlineBody fails reads with ErrBodyTimeout once the deadline passes,
+// however slowly the client trickles the body
+type deadlineBody struct {
+	io.ReadCloser
+	deadline time.Time
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func (d *deadlineBody) Read(p []byte) (int, error) {
+	wait := time.Until(d.deadline)
+	if wait <= 0 {
+		return 0, ErrBodyTimeout
+	}
+
+	// Read into a private buffer, p must not be written after a timeout
+	buf := make([]byte, len(p))
+	result := make(chan readResult, 1)
+	go func() {
+		n, err := d.ReadCloser.Read(buf)
+		result <- readResult{n: n, err: err}
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return 0, ErrBodyTimeout
+	case res := <-result:
+		return copy(p, buf[:res.n]), res.err
+	}
+}
+
+type transportConfig struct {
+	path        []string
+	accountPath []string
+	methods     map[Operation]string
+	maxMemory   int64
+}
+
+// allow checks the request method against the one configured for op
+func (c *transportConfig) allow(r *http.Request, op Operation) error {
+	method, ok := c.methods[op]
+	if !ok {
+		method = defaultMethods[op]
+	}
+	if r.Method != method {
+		return &MethodError{Allow: method}
+	}
+	return nil
+}
+
+// TransportOption customizes a built-in Transport
+type TransportOption func(*transportConfig)
+
+// WithJSONPath makes the JSON transport decode fields from a nested object,
+// e.g. WithJSONPath("data", "credentials") for {"data":{"credentials":{...}}}
+func WithJSONPath(path ...string) TransportOption {
+	return func(c *transportConfig) {
+		c.path = path
+	}
+}
+
+// WithMethods overrides the HTTP method accepted per operation
+func WithMethods(methods map[Operation]string) TransportOption {
+	return func(c *transportConfig) {
+		if c.methods == nil {
+			c.methods = make(map[Operation]string, len(methods))
+		}
+		for op, method := range methods {
+			c.methods[op] = method
+		}
+	}
+}
+
+// WithAccountPath sets where SignUp reads the raw account object from,
+// relative to the body root. By default it is the "account" field next to
+// the credentials.
+func WithAccountPath(path ...string) TransportOption {
+	return func(c *transportConfig) {
+		c.accountPath = path
+	}
+}
+
+// WithMethod overrides the HTTP method accepted for one operation, e.g.
+// WithMethod(OpSetRole, http.MethodPut)
+func WithMethod(op Operation, method string) TransportOption {
+	return WithMethods(map[Operation]string{op: method})
+}
+
+// WithMaxMemory caps the multipart/form-data bytes the form transport keeps in
+// memory, larger files spill to temporary files. 32 MB by default.
+func WithMaxMemory(bytes int64) TransportOption {
+	return func(c *transportConfig) {
+		c.maxMemory = bytes
+	}
+}
+
+type jsonTranport struct {
+	config transportConfig
+}
+
+// lookup descends into raw along a path of object keys
+func lookup(raw json.RawMessage, path []string) (json.RawMessage, error) {
+	for _, key := range path {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		next, ok := obj[key]
+		if !ok {
+			return nil, fmt.Errorf("goard: missing %q in request body", key)
+		}
+		raw = next
+	}
+	return raw, nil
+}
+
+func (t *jsonTranport) body(r *http.Request) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (t *jsonTranport) decode(r *http.Request, v any) error {
+	if len(t.config.path) == 0 {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	raw, err := t.body(r)
+	if err != nil {
+		return err
+	}
+	if raw, err = lookup(raw, t.config.path); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
 
 func (t *jsonTranport) SignIn(r *http.Request) (login, password string, err error) {
-	if r.Method != http.MethodPost {
-		return "", "", ErrMethod
+	login, password, _, err = t.SignInScoped(r)
+	return login, password, err
+}
+
+// SignInScoped implements ScopedTransport, reading an optional "scopes" array
+func (t *jsonTranport) SignInScoped(r *http.Request) (login, password string, scopes []string, err error) {
+	if err := t.config.allow(r, OpSignIn); err != nil {
+		return "", "", nil, err
 	}
 	var req struct {
-		Login    string `json:"login"`
-		Password string `json:"password"`
+		Login    string   `json:"login"`
+		Password string   `json:"password"`
+		Scopes   []string `json:"scopes"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return "", "", err
+	if err := t.decode(r, &req); err != nil {
+		return "", "", nil, err
 	}
-	return req.Login, req.Password, nil
+	return req.Login, req.Password, req.Scopes, nil
 }
 
 func (t *jsonTranport) SignUp(r *http.Request) (account json.RawMessage, login, password string, err error) {
-	if r.Method != http.MethodPost {
-		return nil, "", "", ErrMethod
+	if err := t.config.allow(r, OpSignUp); err != nil {
+		return nil, "", "", err
+	}
+	raw, err := t.body(r)
+	if err != nil {
+		return nil, "", "", err
+	}
+	creds, err := lookup(raw, t.config.path)
+	if err != nil {
+		return nil, "", "", err
 	}
 	var req struct {
 		Account  json.RawMessage `json:"account"`
 		Login    string          `json:"login"`
 		Password string          `json:"password"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(creds, &req); err != nil {
 		return nil, "", "", err
 	}
+	if t.config.accountPath != nil {
+		if req.Account, err = lookup(raw, t.config.accountPath); err != nil {
+			return nil, "", "", err
+		}
+	}
 	return req.Account, req.Login, req.Password, nil
 }
 
 func (t *jsonTranport) SetRole(r *http.Request) (account int64, role string, err error) {
-	if r.Method != http.MethodPatch {
-		return 0, "", ErrMethod
+	if err := t.config.allow(r, OpSetRole); err != nil {
+		return 0, "", err
 	}
 	var req struct {
 		Account int64  `json:"account"`
 		Role    string `json:"role"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := t.decode(r, &req); err != nil {
 		return 0, "", err
 	}
 	return req.Account, req.Role, nil
 }
 
+// SetPermission implements PermissionTransport.
+func (t *jsonTranport) SetPermission(r *http.Request) (account int64, permission string, err error) {
+	return t.permission(r, OpSetPermission)
+}
+
+// UnsetPermission implements PermissionTransport.
+func (t *jsonTranport) UnsetPermission(r *http.Request) (account int64, permission string, err error) {
+	return t.permission(r, OpUnsetPermission)
+}
+
+func (t *jsonTranport) permission(r *http.Request, op Operation) (account int64, permission string, err error) {
+	if err := t.config.allow(r, op); err != nil {
+		return 0, "", err
+	}
+	var req struct {
+		Account    int64  `json:"account"`
+		Permission string `json:"permission"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return 0, "", err
+	}
+	return req.Account, req.Permission, nil
+}
+
 func (t *jsonTranport) UnsetRole(r *http.Request) (account int64, role string, err error) {
-	if r.Method != http.MethodPatch {
-		return 0, "", ErrMethod
+	if err := t.config.allow(r, OpUnsetRole); err != nil {
+		return 0, "", err
 	}
 	var req struct {
 		Account int64  `json:"account"`
 		Role    string `json:"role"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := t.decode(r, &req); err != nil {
 		return 0, "", err
 	}
 	return req.Account, req.Role, nil
 }
 
-func NewJSONTransport() Transport {
-	return &jsonTranport{}
+// Offboard implements OffboardTransport, reading {"account": 0}
+func (t *jsonTranport) Offboard(r *http.Request) (account int64, err error) {
+	if err := t.config.allow(r, OpOffboard); err != nil {
+		return 0, err
+	}
+	var req struct {
+		Account int64 `json:"account"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return 0, err
+	}
+	return req.Account, nil
+}
+
+// VerifyPassword implements VerifyTransport, reading {"password": "..."}
+func (t *jsonTranport) VerifyPassword(r *http.Request) (password string, err error) {
+	if err := t.config.allow(r, OpVerify); err != nil {
+		return "", err
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return "", err
+	}
+	return req.Password, nil
+}
+
+// ChangePassword implements PasswordTransport, reading
+// {"current_password": "...", "password": "..."}
+func (t *jsonTranport) ChangePassword(r *http.Request) (current, password string, err error) {
+	if err := t.config.allow(r, OpChangePassword); err != nil {
+		return "", "", err
+	}
+	var req struct {
+		Current  string `json:"current_password"`
+		Password string `json:"password"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return "", "", err
+	}
+	return req.Current, req.Password, nil
+}
+
+// RequestUnlock implements UnlockTransport, reading {"login": "..."}
+func (t *jsonTranport) RequestUnlock(r *http.Request) (login string, err error) {
+	if err := t.config.allow(r, OpRequestUnlock); err != nil {
+		return "", err
+	}
+	var req struct {
+		Login string `json:"login"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return "", err
+	}
+	return req.Login, nil
+}
+
+// Unlock implements UnlockTransport, reading {"token": "..."}
+func (t *jsonTranport) Unlock(r *http.Request) (token string, err error) {
+	if err := t.config.allow(r, OpUnlock); err != nil {
+		return "", err
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return "", err
+	}
+	return req.Token, nil
+}
+
+// CheckPermissions implements CheckTransport, reading {"permissions": ["..."]}
+func (t *jsonTranport) CheckPermissions(r *http.Request) (permissions []string, err error) {
+	if err := t.config.allow(r, OpCheck); err != nil {
+		return nil, err
+	}
+	var req struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := t.decode(r, &req); err != nil {
+		return nil, err
+	}
+	return req.Permissions, nil
+}
+
+// WriteSignIn implements SignInWriter, answering 200 with {"session_id": "...", "expires_at": "..."},
+// adding "must_change_password": true for flagged accounts
+func (t *jsonTranport) WriteSignIn(w http.ResponseWriter, session *Session) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(&struct {
+		SessionID          string    `json:"session_id"`
+		ExpiresAt          time.Time `json:"expires_at"`
+		MustChangePassword bool      `json:"must_change_password,omitempty"`
+	}{
+		SessionID:          session.id,
+		ExpiresAt:          session.exp,
+		MustChangePassword: session.MustChangePassword(),
+	})
+}
+
+func NewJSONTransport(options ...TransportOption) Transport {
+	t := &jsonTranport{}
+	for _, option := range options {
+		option(&t.config)
+	}
+	return t
 }
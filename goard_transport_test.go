@@ -0,0 +1,193 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request builds a request carrying body
+func request(method, body string) *http.Request {
+	return httptest.NewRequest(method, "/", strings.NewReader(body))
+}
+
+func TestJSONTransportNestedEnvelope(t *testing.T) {
+	transport := NewJSONTransport(WithJSONPath("data", "credentials"), WithAccountPath("data", "profile"))
+
+	login, password, err := transport.SignIn(request(http.MethodPost,
+		`{"data":{"credentials":{"login":"alice","password":"Secret-pass-1"}}}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "alice" || password != "Secret-pass-1" {
+		t.Fatalf("SignIn = %q %q, want alice Secret-pass-1", login, password)
+	}
+
+	account, login, password, err := transport.SignUp(request(http.MethodPost,
+		`{"data":{"credentials":{"login":"bob","password":"Secret-pass-2"},"profile":{"name":"Bob"}}}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login != "bob" || password != "Secret-pass-2" || string(account) != `{"name":"Bob"}` {
+		t.Fatalf("SignUp = %s %q %q", account, login, password)
+	}
+
+	if _, _, err := transport.SignIn(request(http.MethodPost, `{"login":"alice","password":"x"}`)); err == nil {
+		t.Fatal("SignIn accepted a body missing the envelope")
+	}
+}
+
+func TestTransportMethods(t *testing.T) {
+	g := newTestGoard(t, &Config{Transport: NewJSONTransport(WithMethods(map[Operation]string{
+		OpSignIn: http.MethodPut,
+	}))})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	signIn := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, request(method, `{"login":"alice","password":"Secret-pass-1"}`))
+		return rec
+	}
+
+	rec := signIn(http.MethodPost)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST = %d, want 405", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != http.MethodPut {
+		t.Fatalf("Allow = %q, want PUT", allow)
+	}
+
+	if rec := signIn(http.MethodPut); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", rec.Code)
+	}
+}
+
+func TestTransportMethod(t *testing.T) {
+	roleBody := `{"account":7,"role":"editor"}`
+
+	custom := NewJSONTransport(WithMethod(OpSetRole, http.MethodPut))
+	if _, _, err := custom.SetRole(request(http.MethodPut, roleBody)); err != nil {
+		t.Fatalf("SetRole over PUT: %v", err)
+	}
+	var method *MethodError
+	if _, _, err := custom.SetRole(request(http.MethodPatch, roleBody)); !errors.As(err, &method) || method.Allow != http.MethodPut {
+		t.Fatalf("SetRole over PATCH = %v, want a MethodError allowing PUT", err)
+	}
+
+	// Other operations keep their defaults
+	if _, _, err := custom.UnsetRole(request(http.MethodPatch, roleBody)); err != nil {
+		t.Fatalf("UnsetRole over PATCH: %v", err)
+	}
+	if _, _, err := custom.SignIn(request(http.MethodPost, `{"login":"alice","password":"Secret-pass-1"}`)); err != nil {
+		t.Fatalf("SignIn over POST: %v", err)
+	}
+
+	plain := NewJSONTransport()
+	if _, _, err := plain.SetRole(request(http.MethodPatch, roleBody)); err != nil {
+		t.Fatalf("default SetRole over PATCH: %v", err)
+	}
+	if _, _, err := plain.SetRole(request(http.MethodPut, roleBody)); !errors.Is(err, ErrMethod) {
+		t.Fatalf("default SetRole over PUT = %v, want ErrMethod", err)
+	}
+}
+
+func TestSignInOutputPerContainer(t *testing.T) {
+	signIn := func(g *Goard) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, request(http.MethodPost, `{"login":"alice","password":"Secret-pass-1"}`))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("SignIn = %d, want 200", rec.Code)
+		}
+		return rec
+	}
+
+	t.Run("cookie", func(t *testing.T) {
+		g := newTestGoard(t, &Config{})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+
+		rec := signIn(g)
+		if _, err := g.Authorize(context.Background(), cookieSession(g, sessionCookie(t, rec))); err != nil {
+			t.Fatalf("cookie session: %v", err)
+		}
+		if rec.Body.Len() != 0 || rec.Header().Get(SessionTokenHeader) != "" {
+			t.Fatalf("HttpOnly cookie session echoed: body %q, header %q", rec.Body.String(), rec.Header().Get(SessionTokenHeader))
+		}
+	})
+
+	t.Run("bearer", func(t *testing.T) {
+		g := newTestGoard(t, &Config{Container: NewBearerContainer()})
+		signUpAccount(t, g, "alice", "Secret-pass-1")
+
+		rec := signIn(g)
+		if len(rec.Result().Cookies()) != 0 {
+			t.Fatalf("bearer sign in set cookies %v", rec.Result().Cookies())
+		}
+
+		var body struct {
+			SessionID string    `json:"session_id"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.SessionID == "" || body.SessionID != rec.Header().Get(SessionTokenHeader) {
+			t.Fatalf("body session %q, header %q", body.SessionID, rec.Header().Get(SessionTokenHeader))
+		}
+
+		session, err := g.Authorize(context.Background(), body.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !session.ExpiresAt().Equal(body.ExpiresAt) {
+			t.Fatalf("expires_at = %v, want %v", body.ExpiresAt, session.ExpiresAt())
+		}
+	})
+}
+
+// slowBody trickles its content a byte at a time, as a slow-loris client would
+type slowBody struct {
+	data  string
+	delay time.Duration
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if b.data == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(b.delay)
+	n := copy(p[:1], b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestBodyTimeout(t *testing.T) {
+	g := newTestGoard(t, &Config{BodyTimeout: 100 * time.Millisecond})
+	signUpAccount(t, g, "alice", "Secret-pass-1")
+
+	signIn := func(delay time.Duration) int {
+		body := &slowBody{data: `{"login":"alice","password":"Secret-pass-1"}`, delay: delay}
+		rec := httptest.NewRecorder()
+		g.SignIn(rec, httptest.NewRequest(http.MethodPost, "/", body))
+		return rec.Code
+	}
+
+	start := time.Now()
+	if code := signIn(20 * time.Millisecond); code != http.StatusRequestTimeout {
+		t.Fatalf("slow body: %d, want 408", code)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("slow body held the handler %v", elapsed)
+	}
+
+	if code := signIn(0); code != http.StatusOK {
+		t.Fatalf("prompt body: %d, want 200", code)
+	}
+}
@@ -1,6 +1,10 @@
 package goard
 
-import "time"
+import (
+	"errors"
+	"slices"
+	"time"
+)
 
 type Admin struct {
 	Account  Account
@@ -10,23 +14,150 @@ type Admin struct {
 
 type Credentials struct {
 	id       int64
+	tenant   string
 	login    string
 	passhash string
 	roles    []string
+	// until - is the expiry of time-boxed role grants, permanent roles are absent
+	until map[string]time.Time
+	// mustChange - forces a password change, e.g. after a hashing upgrade
+	mustChange bool
+	// permissions - are fine grained grants such as posts:write, see PermissionDatabase
+	permissions []string
 }
 
 func (c *Credentials) ID() int64 {
 	return c.id
 }
 
+func (c *Credentials) Tenant() string {
+	return c.tenant
+}
+
 func (c *Credentials) Login() string {
 	return c.login
 }
 
+func (c *Credentials) MustChangePassword() bool {
+	return c.mustChange
+}
+
+// Roles are sorted alphabetically, time-boxed grants past their expiry are left out
 func (c *Credentials) Roles() []string {
-	return c.roles
+	return c.activeRoles(time.Now())
+}
+
+// Permissions are sorted alphabetically, nil for databases keeping none
+func (c *Credentials) Permissions() []string {
+	return c.permissions
+}
+
+// RoleExpiresAt reports when a time-boxed role grant lapses, false for permanent roles
+func (c *Credentials) RoleExpiresAt(role string) (time.Time, bool) {
+	until, ok := c.until[role]
+	return until, ok
+}
+
+func (c *Credentials) activeRoles(now time.Time) []string {
+	if len(c.until) == 0 {
+		return c.roles
+	}
+
+	roles := make([]string, 0, len(c.roles))
+	for _, role := range c.roles {
+		if until, ok := c.until[role]; ok && !now.Before(until) {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// Claims is the session data a stateless container embeds into its token
+type Claims struct {
+	SessionID   string
+	Account     int64
+	Roles       []string
+	ExpiresAt   time.Time
+	IssuedAt    time.Time
+	Admin       bool
+	Shard       string
+	Scopes      []string
+	Permissions []string
+	// MustChangePassword - flags a session whose account must change its password
+	MustChangePassword bool
+}
+
+// BaseAccount implements Account, embed it in app account types
+type BaseAccount struct {
+	ID int64
+}
+
+func (a BaseAccount) GetID() int64 {
+	return a.ID
+}
+
+// AccountFunc adapts a function to Account
+type AccountFunc func() int64
+
+func (f AccountFunc) GetID() int64 {
+	return f()
+}
+
+// AuditEvent describes a privileged action performed through Goard
+type AuditEvent struct {
+	Action string
+	Actor  int64
+	Target int64
+	At     time.Time
+	Err    error
+}
+
+// OffboardError reports which offboarding steps failed, nil fields succeeded
+type OffboardError struct {
+	Sessions    error
+	Credentials error
+	Account     error
+}
+
+func (e *OffboardError) Error() string {
+	return "offboarding partially failed: " + errors.Join(e.Unwrap()...).Error()
+}
+
+func (e *OffboardError) Unwrap() []error {
+	errs := make([]error, 0, 3)
+	for _, err := range []error{e.Sessions, e.Credentials, e.Account} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
 }
 
+// SessionState is the review state of a session
+type SessionState int
+
+const (
+	// SessionActive - is a regular session
+	SessionActive SessionState = iota
+	// SessionQuarantined - is a session under review, blocked from privileged routes
+	SessionQuarantined
+	// SessionRevoked - is a terminated session
+	SessionRevoked
+)
+
+// RoleChangePolicy is how live sessions react to a role renamed or deleted globally
+type RoleChangePolicy int
+
+const (
+	// RoleChangeRefresh - updates the roles of affected sessions at once
+	RoleChangeRefresh RoleChangePolicy = iota
+	// RoleChangeOnGuard - reloads the roles of affected sessions on their next guarded request
+	RoleChangeOnGuard
+	// RoleChangeRevoke - revokes affected sessions, forcing a new sign in
+	RoleChangeRevoke
+)
+
 type Session struct {
 	id          string
 	account     Account
@@ -34,6 +165,18 @@ type Session struct {
 	exp         time.Time
 	iss         time.Time
 	admin       bool
+	state       SessionState
+	shard       string
+	// refreshed - is when the account snapshot was last fetched, zero means at iss
+	refreshed time.Time
+	// rolesStale - makes Guard reload the roles from the database, see RoleChangeOnGuard
+	rolesStale bool
+	// expiring - marks a session admitted within the ExpiryGrace past exp
+	expiring bool
+	// scopes - limits what the session may do, nil leaves it unlimited
+	scopes []string
+	// hierarchy - expands the roles into EffectiveRoles, see Config.RoleHierarchy
+	hierarchy roleHierarchy
 }
 
 func (s *Session) ID() string {
@@ -44,6 +187,9 @@ func (s *Session) Account() Account {
 	return s.account
 }
 
+// ExpiresAt is derived from IssuedAt with time.Add and keeps its monotonic
+// clock reading, so expiry checks are immune to wall clock steps. Sessions
+// restored from a snapshot or a token carry wall clock time only.
 func (s *Session) ExpiresAt() time.Time {
 	return s.exp
 }
@@ -52,10 +198,81 @@ func (s *Session) IssuedAt() time.Time {
 	return s.iss
 }
 
+// Shard is the tenant/database shard the session was signed in on
+func (s *Session) Shard() string {
+	return s.shard
+}
+
+func (s *Session) State() SessionState {
+	return s.state
+}
+
 func (s *Session) IsAdmin() bool {
 	return s.admin
 }
 
+// MustChangePassword reports whether the account was flagged to change its
+// password, e.g. by FlagOutdatedHashes. ChangePassword clears it.
+func (s *Session) MustChangePassword() bool {
+	return s.credentials != nil && s.credentials.mustChange
+}
+
+// Scopes returns the sorted scopes the session was limited to at sign in, nil
+// when it is not limited
+func (s *Session) Scopes() []string {
+	return slices.Clone(s.scopes)
+}
+
+// HasScope reports whether the session may act within scope. Sessions signed
+// in without scopes are not limited and have every scope.
+func (s *Session) HasScope(scope string) bool {
+	return s.scopes == nil || slices.Contains(s.scopes, scope)
+}
+
+// Roles returns the sorted session roles, nil when the session carries none
 func (s *Session) Roles() []string {
-	return s.credentials.roles
+	if s.credentials == nil {
+		return nil
+	}
+	return s.credentials.Roles()
+}
+
+// EffectiveRoles returns the sorted session roles along with the roles they
+// imply through Config.RoleHierarchy
+func (s *Session) EffectiveRoles() []string {
+	return s.hierarchy.expand(s.Roles())
+}
+
+// Permissions returns the fine grained permissions of the session account
+func (s *Session) Permissions() []string {
+	if s.credentials == nil {
+		return nil
+	}
+	return s.credentials.Permissions()
+}
+
+// HasPermissions reports for each permission whether the session holds it.
+// The effective roles and the fine grained permissions count, superuser
+// sessions hold every permission as RequirePermission admits them.
+func (s *Session) HasPermissions(permissions ...string) map[string]bool {
+	result := make(map[string]bool, len(permissions))
+	if s.admin {
+		for _, permission := range permissions {
+			result[permission] = true
+		}
+		return result
+	}
+
+	held := make(map[string]struct{})
+	for _, role := range s.EffectiveRoles() {
+		held[role] = struct{}{}
+	}
+	for _, permission := range s.Permissions() {
+		held[permission] = struct{}{}
+	}
+
+	for _, permission := range permissions {
+		_, result[permission] = held[permission]
+	}
+	return result
 }
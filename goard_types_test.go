@@ -0,0 +1,45 @@
+package goard
+
+import (
+	"context"
+	"testing"
+)
+
+// member is an app account needing no GetID of its own
+type member struct {
+	BaseAccount
+	Email string
+}
+
+// memberApp serves member accounts
+type memberApp struct {
+	*testApp
+}
+
+func (a *memberApp) AccountByID(ctx context.Context, id int64) (Account, error) {
+	if _, err := a.testApp.AccountByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return member{BaseAccount: BaseAccount{ID: id}, Email: "alice@example.com"}, nil
+}
+
+func TestBaseAccountEmbedding(t *testing.T) {
+	var account Account = member{BaseAccount: BaseAccount{ID: 42}}
+	if id := account.GetID(); id != 42 {
+		t.Fatalf("GetID = %d, want 42", id)
+	}
+	if id := AccountFunc(func() int64 { return 7 }).GetID(); id != 7 {
+		t.Fatalf("AccountFunc GetID = %d, want 7", id)
+	}
+
+	g := newTestGoard(t, &Config{App: &memberApp{testApp: &testApp{}}})
+	id := signUpAccount(t, g, "alice", "Secret-pass-1")
+	session, err := g.AuthenticatePassword(context.Background(), "alice", "Secret-pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedIn, ok := session.Account().(member)
+	if !ok || signedIn.GetID() != id || signedIn.Email != "alice@example.com" {
+		t.Fatalf("session account = %#v, want member %d", session.Account(), id)
+	}
+}
@@ -1,6 +1,12 @@
 package goard
 
-import "context"
+import (
+	"context"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
 
 type noValidation struct{}
 
@@ -15,3 +21,105 @@ func (v *noValidation) Validate(_ context.Context, login string, password string
 func NewDefaultValidator() Validator {
 	return &noValidation{}
 }
+
+// UUIDValidator accepts only canonical UUID session IDs as issued by Goard
+func UUIDValidator(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// ValidationRule names a credentials requirement a validator may report as failed
+type ValidationRule string
+
+const (
+	RuleEmptyLogin    ValidationRule = "empty_login"
+	RuleTooShort      ValidationRule = "too_short"
+	RuleMissingUpper  ValidationRule = "missing_upper"
+	RuleMissingLower  ValidationRule = "missing_lower"
+	RuleMissingDigit  ValidationRule = "missing_digit"
+	RuleMissingSymbol ValidationRule = "missing_symbol"
+)
+
+// ValidationError lists the rules failed credentials broke, it matches ErrBadCredentials
+type ValidationError struct {
+	Rules []ValidationRule
+}
+
+func (e *ValidationError) Error() string {
+	return ErrBadCredentials.Error()
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrBadCredentials
+}
+
+// ComplexityRules are the password requirements of the complexity validator
+type ComplexityRules struct {
+	MinLength int
+	Upper     bool
+	Lower     bool
+	Digit     bool
+	Symbol    bool
+}
+
+type complexityValidator struct {
+	rules ComplexityRules
+}
+
+func (v *complexityValidator) Validate(ctx context.Context, login string, password string) bool {
+	return len(v.Failures(ctx, login, password)) == 0
+}
+
+func (v *complexityValidator) Failures(_ context.Context, login string, password string) []ValidationRule {
+	var failed []ValidationRule
+
+	if login == "" {
+		failed = append(failed, RuleEmptyLogin)
+	}
+
+	if utf8.RuneCountInString(password) < max(v.rules.MinLength, 1) {
+		failed = append(failed, RuleTooShort)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	if v.rules.Upper && !upper {
+		failed = append(failed, RuleMissingUpper)
+	}
+	if v.rules.Lower && !lower {
+		failed = append(failed, RuleMissingLower)
+	}
+	if v.rules.Digit && !digit {
+		failed = append(failed, RuleMissingDigit)
+	}
+	if v.rules.Symbol && !symbol {
+		failed = append(failed, RuleMissingSymbol)
+	}
+
+	return failed
+}
+
+func NewComplexityValidator(rules ComplexityRules) RuleValidator {
+	return &complexityValidator{
+		rules: rules,
+	}
+}
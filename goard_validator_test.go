@@ -0,0 +1,48 @@
+package goard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestComplexityValidatorFailures(t *testing.T) {
+	v := NewComplexityValidator(ComplexityRules{MinLength: 10, Upper: true, Digit: true})
+
+	rules := v.Failures(context.Background(), "alice", "short-1")
+	want := []ValidationRule{RuleTooShort, RuleMissingUpper}
+	if !slices.Equal(rules, want) {
+		t.Fatalf("Failures = %v, want %v", rules, want)
+	}
+
+	if rules := v.Failures(context.Background(), "alice", "Long-enough-1"); len(rules) != 0 {
+		t.Fatalf("Failures = %v for a valid password", rules)
+	}
+}
+
+func TestSignUpReportsFailedRules(t *testing.T) {
+	g := newTestGoard(t, &Config{
+		Validator:  NewComplexityValidator(ComplexityRules{MinLength: 10, Upper: true, Digit: true}),
+		JSONErrors: true,
+	})
+
+	rec := httptest.NewRecorder()
+	g.SignUp(rec, request(http.MethodPost, `{"account":{},"login":"alice","password":"short-1"}`))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("SignUp = %d, want 400", rec.Code)
+	}
+
+	var body struct {
+		Code  string           `json:"code"`
+		Rules []ValidationRule `json:"rules"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "bad_credentials" || !slices.Equal(body.Rules, []ValidationRule{RuleTooShort, RuleMissingUpper}) {
+		t.Fatalf("body = %+v", body)
+	}
+}